@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"net"
+	"slices"
+
+	"github.com/rounakkumarsingh/dns-server/dns"
+)
+
+// maxAliasChain is the number of names, the query name included, that a
+// single query may be redirected through by CNAME and DNAME records.
+const maxAliasChain = 12
+
+// aliasChainKey is the context key of the names an answer has been redirected
+// through so far, starting with the original query name.
+type aliasChainKey struct{}
+
+func aliasChain(ctx context.Context) []dns.Name {
+	chain, _ := ctx.Value(aliasChainKey{}).([]dns.Name)
+	return chain
+}
+
+// extendAliasChain adds target to the alias chain, failing when the chain gets
+// too long or target was already visited.
+func extendAliasChain(chain []dns.Name, target dns.Name) ([]dns.Name, error) {
+	if slices.ContainsFunc(chain, target.Equal) {
+		return nil, serverFailure(dns.EDECodeType.Other, "CNAME/DNAME loop: %v leads back to %s", chain, target)
+	}
+	if len(chain) >= maxAliasChain {
+		return nil, serverFailure(dns.EDECodeType.Other, "CNAME/DNAME chain from %s longer than %d", chain[0], maxAliasChain)
+	}
+	return append(slices.Clip(chain), target), nil
+}
+
+// followAliases walks the CNAME and DNAME records of answers from domain. It
+// returns the alias records on the way followed by the records of recordType
+// for the last name, the extended alias chain and, if the records for the
+// last name are not in answers, that name. A DNAME is answered with a CNAME
+// synthesized from it (RFC 6672). On error the alias records collected so far
+// are still returned.
+func followAliases(answers []dns.DNSRecord, domain dns.Name, recordType dns.RecordType, chain []dns.Name) ([]dns.DNSRecord, []dns.Name, dns.Name, error) {
+	if len(chain) == 0 {
+		chain = []dns.Name{domain}
+	}
+
+	var records []dns.DNSRecord
+	name := domain
+	for {
+		var found []dns.DNSRecord
+		for _, answer := range answers {
+			if answer.Preamble().Type == recordType && answer.Preamble().Name.Equal(name) {
+				found = append(found, answer)
+			}
+		}
+		if len(found) > 0 {
+			return append(records, found...), chain, "", nil
+		}
+
+		target, alias, err := aliasTarget(answers, name)
+		if err != nil {
+			return append(records, alias...), nil, "", err
+		}
+		if alias == nil {
+			if len(records) == 0 {
+				// Not an alias, the response carries no answer for domain.
+				return nil, chain, "", nil
+			}
+			return records, chain, name, nil
+		}
+
+		records = append(records, alias...)
+		if chain, err = extendAliasChain(chain, target); err != nil {
+			return records, nil, "", err
+		}
+		name = target
+	}
+}
+
+// aliasTarget looks for a DNAME above name or a CNAME at name in answers. It
+// returns the name they redirect to along with the records to put in the
+// response for it.
+func aliasTarget(answers []dns.DNSRecord, name dns.Name) (dns.Name, []dns.DNSRecord, error) {
+	for _, answer := range answers {
+		dname, ok := answer.(dns.DNAMERecord)
+		if !ok || !name.IsSubdomainOf(dname.Name) || name.Equal(dname.Name) {
+			continue
+		}
+		target, err := dname.SubstituteDNAME(name)
+		if err != nil {
+			// The synthesized name does not fit in 255 bytes, which is
+			// answered with the DNAME alone (RFC 6672 section 2.2).
+			return "", []dns.DNSRecord{dname}, RESCODEError{Code: dns.DNSResponseCodeType.YXDomain}
+		}
+		cname := dns.CNAMERecord{
+			DNSRecordPreamble: dns.DNSRecordPreamble{Name: name, Type: dns.RType.CNAME, Class: dname.Class, TTL: dname.TTL},
+			CanonicalName:     target,
+		}
+		return target, []dns.DNSRecord{dname, cname}, nil
+	}
+
+	for _, answer := range answers {
+		if cname, ok := answer.(dns.CNAMERecord); ok && cname.Name.Equal(name) {
+			return cname.CanonicalName, []dns.DNSRecord{cname}, nil
+		}
+	}
+	return "", nil, nil
+}
+
+// resolveAlias resolves the target of a CNAME or DNAME from the best
+// delegation we know: the nameservers of zone when the target is inside it,
+// otherwise any configured zone route or the root.
+func resolveAlias(ctx context.Context, nsServers map[dns.Name][]net.IP, zone dns.Name, target dns.Name, recordType dns.RecordType, chain []dns.Name, depth uint) ([]dns.DNSRecord, error) {
+	ctx = context.WithValue(ctx, aliasChainKey{}, chain)
+	if !zone.IsRoot() && target.IsSubdomainOf(zone) {
+		return resolve(ctx, nsServers, zone, target, recordType, depth+1)
+	}
+	return lookup(ctx, target, recordType)
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/rounakkumarsingh/dns-server/dns"
+)
+
+func preamble(name dns.Name, recordType dns.RecordType) dns.DNSRecordPreamble {
+	return dns.DNSRecordPreamble{Name: name, Type: recordType, Class: dns.ClassType.IN, TTL: 300}
+}
+
+func cname(name, target dns.Name) dns.CNAMERecord {
+	return dns.CNAMERecord{DNSRecordPreamble: preamble(name, dns.RType.CNAME), CanonicalName: target}
+}
+
+func dname(name, target dns.Name) dns.DNAMERecord {
+	return dns.DNAMERecord{DNSRecordPreamble: preamble(name, dns.RType.DNAME), Target: target}
+}
+
+func aRecord(name dns.Name, ip string) dns.ADNSRecord {
+	return dns.ADNSRecord{DNSRecordPreamble: preamble(name, dns.RType.A), IP: net.ParseIP(ip)}
+}
+
+// recordNames lists the type and owner of records, which is enough to tell
+// the records of these tests apart.
+func recordNames(records []dns.DNSRecord) []string {
+	var names []string
+	for _, record := range records {
+		names = append(names, fmt.Sprintf("%s %s", record.Preamble().Type, record.Preamble().Name.Canonical()))
+	}
+	return names
+}
+
+func TestFollowAliases(t *testing.T) {
+	tests := []struct {
+		name        string
+		answers     []dns.DNSRecord
+		domain      dns.Name
+		wantRecords []string
+		wantChain   []dns.Name
+		wantNext    dns.Name
+	}{
+		{
+			name:        "direct answer",
+			answers:     []dns.DNSRecord{aRecord("www.example.com.", "192.0.2.1")},
+			domain:      "WWW.example.com.",
+			wantRecords: []string{"A www.example.com."},
+			wantChain:   []dns.Name{"WWW.example.com."},
+		},
+		{
+			name:      "no answer",
+			answers:   []dns.DNSRecord{aRecord("other.example.com.", "192.0.2.1")},
+			domain:    "www.example.com.",
+			wantChain: []dns.Name{"www.example.com."},
+		},
+		{
+			name: "CNAME chain in the response",
+			answers: []dns.DNSRecord{
+				cname("www.example.com.", "web.example.com."),
+				cname("web.example.com.", "host.example.net."),
+				aRecord("host.example.net.", "192.0.2.2"),
+			},
+			domain:      "www.example.com.",
+			wantRecords: []string{"CNAME www.example.com.", "CNAME web.example.com.", "A host.example.net."},
+			wantChain:   []dns.Name{"www.example.com.", "web.example.com.", "host.example.net."},
+		},
+		{
+			name:        "CNAME leaving the response",
+			answers:     []dns.DNSRecord{cname("www.example.com.", "host.example.net.")},
+			domain:      "www.example.com.",
+			wantRecords: []string{"CNAME www.example.com."},
+			wantChain:   []dns.Name{"www.example.com.", "host.example.net."},
+			wantNext:    "host.example.net.",
+		},
+		{
+			name: "DNAME with synthesized CNAME",
+			answers: []dns.DNSRecord{
+				dname("example.com.", "example.net."),
+				aRecord("www.example.net.", "192.0.2.3"),
+			},
+			domain:      "www.example.com.",
+			wantRecords: []string{"DNAME example.com.", "CNAME www.example.com.", "A www.example.net."},
+			wantChain:   []dns.Name{"www.example.com.", "www.example.net."},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, chain, next, err := followAliases(tt.answers, tt.domain, dns.RType.A, nil)
+			if err != nil {
+				t.Fatalf("followAliases() error = %v", err)
+			}
+			if got := recordNames(records); !slices.Equal(got, tt.wantRecords) {
+				t.Errorf("records = %v, want %v", got, tt.wantRecords)
+			}
+			if !slices.Equal(chain, tt.wantChain) {
+				t.Errorf("chain = %v, want %v", chain, tt.wantChain)
+			}
+			if next != tt.wantNext {
+				t.Errorf("next = %q, want %q", next, tt.wantNext)
+			}
+		})
+	}
+}
+
+func TestFollowAliasesErrors(t *testing.T) {
+	long := []dns.DNSRecord{}
+	for i := range maxAliasChain {
+		long = append(long, cname(dns.Name(fmt.Sprintf("a%d.example.com.", i)), dns.Name(fmt.Sprintf("a%d.example.com.", i+1))))
+	}
+
+	tests := []struct {
+		name        string
+		answers     []dns.DNSRecord
+		chain       []dns.Name
+		wantCode    dns.DNSResponseCode
+		wantRecords int
+	}{
+		{
+			name:        "CNAME loop",
+			answers:     []dns.DNSRecord{cname("a0.example.com.", "b.example.com."), cname("b.example.com.", "A0.example.com.")},
+			wantCode:    dns.DNSResponseCodeType.ServerFailure,
+			wantRecords: 2,
+		},
+		{
+			name:        "loop through an earlier response",
+			answers:     []dns.DNSRecord{cname("a0.example.com.", "start.example.com.")},
+			chain:       []dns.Name{"start.example.com.", "a0.example.com."},
+			wantCode:    dns.DNSResponseCodeType.ServerFailure,
+			wantRecords: 1,
+		},
+		{
+			name:        "chain too long",
+			answers:     long,
+			wantCode:    dns.DNSResponseCodeType.ServerFailure,
+			wantRecords: maxAliasChain,
+		},
+		{
+			name:        "DNAME substitution too long",
+			answers:     []dns.DNSRecord{dname("example.com.", dns.Name(fmt.Sprintf("%[1]s.%[1]s.%[1]s.%[2]s.", strings.Repeat("x", 63), strings.Repeat("y", 61))))},
+			wantCode:    dns.DNSResponseCodeType.YXDomain,
+			wantRecords: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, _, _, err := followAliases(tt.answers, "a0.example.com.", dns.RType.A, tt.chain)
+			var rescodeErr RESCODEError
+			if !errors.As(err, &rescodeErr) || rescodeErr.Code != tt.wantCode {
+				t.Fatalf("followAliases() error = %v, want %s", err, tt.wantCode)
+			}
+			if len(records) != tt.wantRecords {
+				t.Errorf("got %d records with the error, want %d: %v", len(records), tt.wantRecords, recordNames(records))
+			}
+		})
+	}
+}
+
+func TestAliasTarget(t *testing.T) {
+	answers := []dns.DNSRecord{
+		dname("example.com.", "example.net."),
+		cname("example.com.", "elsewhere.example.org."),
+		cname("mail.example.org.", "mx.example.org."),
+	}
+	tests := []struct {
+		name        string
+		domain      dns.Name
+		wantTarget  dns.Name
+		wantRecords []string
+	}{
+		{"DNAME below its owner", "a.b.Example.com.", "a.b.example.net.", []string{"DNAME example.com.", "CNAME a.b.example.com."}},
+		{"DNAME does not apply to its owner", "example.com.", "elsewhere.example.org.", []string{"CNAME example.com."}},
+		{"CNAME", "MAIL.example.org.", "mx.example.org.", []string{"CNAME mail.example.org."}},
+		{"no alias", "www.example.org.", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target, records, err := aliasTarget(answers, tt.domain)
+			if err != nil {
+				t.Fatalf("aliasTarget() error = %v", err)
+			}
+			if target != tt.wantTarget {
+				t.Errorf("target = %q, want %q", target, tt.wantTarget)
+			}
+			if got := recordNames(records); !slices.Equal(got, tt.wantRecords) {
+				t.Errorf("records = %v, want %v", got, tt.wantRecords)
+			}
+		})
+	}
+
+	// The synthesized CNAME takes its owner from the query and its TTL from
+	// the DNAME.
+	_, records, _ := aliasTarget(answers, "www.Example.com.")
+	synthesized := records[1].(dns.CNAMERecord)
+	if synthesized.Name != "www.Example.com." || synthesized.CanonicalName != "www.example.net." || synthesized.TTL != 300 {
+		t.Errorf("synthesized CNAME = %s", synthesized)
+	}
+}
+
+func TestExtendAliasChain(t *testing.T) {
+	chain := []dns.Name{"a.example."}
+	for i := 1; i < maxAliasChain; i++ {
+		var err error
+		if chain, err = extendAliasChain(chain, dns.Name(fmt.Sprintf("a%d.example.", i))); err != nil {
+			t.Fatalf("extending a chain of %d names: %v", i, err)
+		}
+	}
+	if len(chain) != maxAliasChain {
+		t.Fatalf("chain has %d names, want %d", len(chain), maxAliasChain)
+	}
+	if _, err := extendAliasChain(chain, "one-more.example."); err == nil {
+		t.Errorf("chain grew past %d names", maxAliasChain)
+	}
+	if _, err := extendAliasChain(chain[:3], "A1.EXAMPLE."); err == nil {
+		t.Error("loop back to a1.example. not detected")
+	}
+}
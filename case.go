@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/rounakkumarsingh/dns-server/dns"
+)
+
+// CaseRandomization randomises the letter case of question names sent by the
+// iterator and requires servers to echo it (draft-vixie-dnsext-dns0x20). An
+// off-path attacker then has to guess the case as well as the query ID.
+var CaseRandomization = true
+
+const (
+	// caseMismatchLimit is the number of responses with the wrong case after
+	// which a server is assumed not to preserve case.
+	caseMismatchLimit = 3
+	// noCaseMemory is how long a server that does not preserve case gets
+	// queries in their original case.
+	noCaseMemory = time.Hour
+)
+
+// caseTracker remembers which upstream servers do not echo the case of the
+// question name.
+type caseTracker struct {
+	mu         sync.Mutex
+	mismatches map[string]int
+	disabled   map[string]time.Time
+}
+
+var upstreamCase = &caseTracker{mismatches: make(map[string]int), disabled: make(map[string]time.Time)}
+
+// enabled reports whether queries to ip should use a randomised case.
+func (t *caseTracker) enabled(ip net.IP) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	since, ok := t.disabled[ip.String()]
+	if !ok {
+		return true
+	}
+	if time.Since(since) > noCaseMemory {
+		delete(t.disabled, ip.String())
+		return true
+	}
+	return false
+}
+
+// matched resets the mismatch count of a server that echoed the case.
+func (t *caseTracker) matched(ip net.IP) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.mismatches, ip.String())
+}
+
+// mismatched counts a response with the wrong case and reports whether that
+// disabled case randomisation for the server.
+func (t *caseTracker) mismatched(ip net.IP) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.mismatches[ip.String()]++
+	if t.mismatches[ip.String()] < caseMismatchLimit {
+		return false
+	}
+	delete(t.mismatches, ip.String())
+	t.disabled[ip.String()] = time.Now()
+	return true
+}
+
+// withRandomCase returns a copy of query with randomised question names.
+func withRandomCase(query dns.DNSPacket) dns.DNSPacket {
+	questions := make([]dns.DNSQuestion, len(query.Questions))
+	for i, question := range query.Questions {
+		question.Domain = question.Domain.RandomCase()
+		questions[i] = question
+	}
+	query.Questions = questions
+	return query
+}
+
+// errCaseMismatch is returned when a server only sent responses that did not
+// echo the case of the question name.
+var errCaseMismatch = errors.New("response did not echo the question name case")
+
+// caseMatches reports whether response spells the question names exactly as
+// query did. Responses that may leave out the question section cannot be
+// checked and are accepted.
+func caseMatches(query dns.DNSPacket, response *dns.DNSPacket) bool {
+	if len(response.Questions) == 0 && questionOptional(response) {
+		return true
+	}
+	if len(response.Questions) != len(query.Questions) {
+		return false
+	}
+	for i, question := range response.Questions {
+		if !question.Domain.EqualCase(query.Questions[i].Domain) {
+			return false
+		}
+	}
+	return true
+}
+
+// queryWithRandomCase sends queryPacket to dnsServer with a randomised
+// question name. Responses that do not echo the case are discarded while
+// waiting for one that does. A server that never sends one is counted
+// towards disabling case randomisation for it.
+func queryWithRandomCase(dnsServer net.IP, queryPacket dns.DNSPacket, timeout time.Duration) (*dns.DNSPacket, error) {
+	if !upstreamCase.enabled(dnsServer) {
+		return queryWithEDNS(dnsServer, queryPacket, timeout, false)
+	}
+
+	responsePacket, err := queryWithEDNS(dnsServer, withRandomCase(queryPacket), timeout, true)
+	if errors.Is(err, errCaseMismatch) {
+		if upstreamCase.mismatched(dnsServer) {
+			log.Printf("Server %s does not preserve case, disabling 0x20 for it", dnsServer)
+		}
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	upstreamCase.matched(dnsServer)
+	return responsePacket, nil
+}
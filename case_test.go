@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/rounakkumarsingh/dns-server/dns"
+)
+
+func TestCaseMatches(t *testing.T) {
+	query := dns.DNSPacket{
+		Header:    dns.DNSHeader{ID: 7, QDCOUNT: 1},
+		Questions: []dns.DNSQuestion{{Domain: "wWw.ExAmple.cOm.", Type: dns.RType.A, Class: dns.ClassType.IN}},
+	}
+	response := func(domain dns.Name, tc uint8, rcode dns.DNSResponseCode) *dns.DNSPacket {
+		packet := &dns.DNSPacket{Header: dns.DNSHeader{ID: 7, QR: 1, TC: tc, RCODE: rcode}}
+		if domain != "" {
+			packet.Questions = []dns.DNSQuestion{{Domain: domain, Type: dns.RType.A, Class: dns.ClassType.IN}}
+		}
+		return packet
+	}
+
+	tests := []struct {
+		name     string
+		response *dns.DNSPacket
+		want     bool
+	}{
+		{"same case", response("wWw.ExAmple.cOm.", 0, dns.DNSResponseCodeType.NoError), true},
+		{"lower case", response("www.example.com.", 0, dns.DNSResponseCodeType.NoError), false},
+		{"no question", response("", 0, dns.DNSResponseCodeType.NoError), false},
+		{"no question, NXDOMAIN", response("", 0, dns.DNSResponseCodeType.NameError), false},
+		{"no question, truncated", response("", 1, dns.DNSResponseCodeType.NoError), true},
+		{"no question, FORMERR", response("", 0, dns.DNSResponseCodeType.FormatError), true},
+		{"no question, NOTIMP", response("", 0, dns.DNSResponseCodeType.NotImplemented), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := caseMatches(query, tt.response); got != tt.want {
+				t.Errorf("caseMatches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -16,7 +16,7 @@ type DNSHeader struct {
 	Z       uint8           // 1 bit
 	AD      uint8           // 1 bit Authentic Data
 	CD      uint8           // 1 bit Checking Disabled
-	RCODE   DNSResponseCode // 4 bits Response Code(Server use)
+	RCODE   DNSResponseCode // 12 bits Response Code(Server use), the upper 8 bits are sent in the OPT record
 	QDCOUNT uint16          // 16 bits number of Questions
 	ANCOUNT uint16          // 16 bits number of Answers Records
 	NSCOUNT uint16          // 16 bits number of Name Servers in Authority Records
@@ -55,7 +55,7 @@ func (h *DNSHeader) ToBytes() ([]byte, error) {
 	if !checkBits(uint(h.CD), 1) {
 		return nil, fmt.Errorf("CD is way too large in the header body")
 	}
-	if !checkBits(uint(h.RCODE), 4) {
+	if !checkBits(uint(h.RCODE), 12) {
 		return nil, fmt.Errorf("RCODE is way too large in the header body")
 	}
 	if !checkBits(uint(h.QDCOUNT), 16) {
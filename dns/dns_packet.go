@@ -26,7 +26,11 @@ func (m *DNSPacket) ToBytes() ([]byte, error) {
 	var offsetMap = make(map[string]uint)
 
 	for _, question := range m.Questions {
-		buf = append(buf, question.ToBytes(offsetMap, uint(len(buf)))...)
+		bytes, err := question.ToBytes(offsetMap, uint(len(buf)))
+		if err != nil {
+			return nil, err
+		}
+		buf = append(buf, bytes...)
 	}
 
 	if m.Header.ANCOUNT != uint16(len(m.Answers)) {
@@ -59,7 +63,14 @@ func (m *DNSPacket) ToBytes() ([]byte, error) {
 		return nil, errors.New("the number of additional records is not same as ARCOUNT in header")
 	}
 
+	hasOPT := false
 	for _, additional := range m.Additional {
+		if opt, ok := additional.(OPTRecord); ok {
+			// The OPT record carries the upper 8 bits of the response code.
+			opt.ExtRCODE = uint8(m.Header.RCODE >> 4)
+			additional = opt
+			hasOPT = true
+		}
 		bytes, err := additional.ToBytes(offsetMap, uint(len(buf)))
 		if err != nil {
 			return nil, err
@@ -67,9 +78,51 @@ func (m *DNSPacket) ToBytes() ([]byte, error) {
 		buf = append(buf, bytes...)
 	}
 
+	if m.Header.RCODE > 0xF && !hasOPT {
+		return nil, fmt.Errorf("response code %s needs an OPT record", m.Header.RCODE)
+	}
+
 	return buf, nil
 }
 
+// ToBytesLimit serializes the packet like ToBytes but makes sure the result
+// fits in limit bytes. Additional records other than OPT are dropped first,
+// then the authority section and finally the answers. Dropping the
+// additional section is harmless, anything more sets TC so that the client
+// retries over TCP (RFC 2181 section 9).
+func (m *DNSPacket) ToBytesLimit(limit int) ([]byte, error) {
+	buf, err := m.ToBytes()
+	if err != nil || len(buf) <= limit {
+		return buf, err
+	}
+
+	trimmed := *m
+	trimmed.Additional = nil
+	for _, additional := range m.Additional {
+		if _, ok := additional.(OPTRecord); ok {
+			trimmed.Additional = append(trimmed.Additional, additional)
+		}
+	}
+	trimmed.Header.ARCOUNT = uint16(len(trimmed.Additional))
+	if buf, err = trimmed.ToBytes(); err != nil || len(buf) <= limit {
+		return buf, err
+	}
+
+	trimmed.Authoratives = nil
+	trimmed.Header.NSCOUNT = 0
+	trimmed.Header.TC = 1
+	if buf, err = trimmed.ToBytes(); err != nil || len(buf) <= limit {
+		return buf, err
+	}
+
+	trimmed.Answers = nil
+	trimmed.Header.ANCOUNT = 0
+	if buf, err = trimmed.ToBytes(); err != nil || len(buf) <= limit {
+		return buf, err
+	}
+	return nil, fmt.Errorf("packet does not fit in %d bytes even without records", limit)
+}
+
 func (m DNSPacket) String() string {
 	result := fmt.Sprintf("DNS Packet:\n%s\n", m.Header.String())
 
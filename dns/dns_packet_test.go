@@ -0,0 +1,153 @@
+package dns
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+)
+
+func TestToBytesLimit(t *testing.T) {
+	preamble := func(name Name, recordType RecordType) DNSRecordPreamble {
+		return DNSRecordPreamble{Name: name, Type: recordType, Class: ClassType.IN, TTL: 300}
+	}
+	packet := DNSPacket{
+		Header:    DNSHeader{ID: 1, QR: 1, QDCOUNT: 1},
+		Questions: []DNSQuestion{{Domain: "example.com.", Type: RType.A, Class: ClassType.IN}},
+		Additional: []DNSRecord{
+			OPTRecord{Name: ".", UDPSize: 1232},
+		},
+	}
+	for i := range 8 {
+		packet.Answers = append(packet.Answers, ADNSRecord{DNSRecordPreamble: preamble("example.com.", RType.A), IP: net.IPv4(192, 0, 2, byte(i))})
+		host := Name(fmt.Sprintf("ns%d.example.com.", i))
+		packet.Authoratives = append(packet.Authoratives, NSDNSRecord{DNSRecordPreamble: preamble("example.com.", RType.NS), Host: host})
+		packet.Additional = append(packet.Additional, AAAARecord{DNSRecordPreamble: preamble(host, RType.AAAA), IP: net.ParseIP("2001:db8::53")})
+	}
+	packet.Header.ANCOUNT, packet.Header.NSCOUNT, packet.Header.ARCOUNT = 8, 8, 9
+
+	size := func(p DNSPacket) int {
+		buf, err := p.ToBytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(buf)
+	}
+	full := size(packet)
+	withoutAdditional := packet
+	withoutAdditional.Additional = packet.Additional[:1]
+	withoutAdditional.Header.ARCOUNT = 1
+	withoutAuthority := withoutAdditional
+	withoutAuthority.Authoratives = nil
+	withoutAuthority.Header.NSCOUNT = 0
+	withoutAnswers := withoutAuthority
+	withoutAnswers.Answers = nil
+	withoutAnswers.Header.ANCOUNT = 0
+
+	tests := []struct {
+		name                 string
+		limit                int
+		answers, authority   uint16
+		additional           uint16
+		truncated, wantError bool
+	}{
+		{"fits", full, 8, 8, 9, false, false},
+		{"additional dropped, OPT kept", full - 1, 8, 8, 1, false, false},
+		{"exactly without additional", size(withoutAdditional), 8, 8, 1, false, false},
+		{"authority dropped", size(withoutAdditional) - 1, 8, 0, 1, true, false},
+		{"answers dropped", size(withoutAuthority) - 1, 0, 0, 1, true, false},
+		{"too small", size(withoutAnswers) - 1, 0, 0, 0, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf, err := packet.ToBytesLimit(tt.limit)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("ToBytesLimit(%d) error = %v, wantError %v", tt.limit, err, tt.wantError)
+			}
+			if tt.wantError {
+				return
+			}
+			if len(buf) > tt.limit {
+				t.Errorf("ToBytesLimit(%d) returned %d bytes", tt.limit, len(buf))
+			}
+			parsed, err := ParseDNSPacket(buf, len(buf))
+			if err != nil && !errors.Is(err, ErrTruncated) {
+				t.Fatalf("parsing the trimmed packet: %v", err)
+			}
+			h := parsed.Header
+			if h.ANCOUNT != tt.answers || h.NSCOUNT != tt.authority || h.ARCOUNT != tt.additional {
+				t.Errorf("counts = %d/%d/%d, want %d/%d/%d", h.ANCOUNT, h.NSCOUNT, h.ARCOUNT, tt.answers, tt.authority, tt.additional)
+			}
+			if (h.TC == 1) != tt.truncated {
+				t.Errorf("TC = %d, want truncated %v", h.TC, tt.truncated)
+			}
+			if _, ok := parsed.Additional[0].(OPTRecord); !ok {
+				t.Error("OPT record dropped")
+			}
+		})
+	}
+
+	if packet.Header.TC != 0 || len(packet.Additional) != 9 {
+		t.Error("ToBytesLimit modified the packet")
+	}
+}
+
+func TestExtendedRCODE(t *testing.T) {
+	tests := []struct {
+		rcode    DNSResponseCode
+		header   byte  // Lower 4 bits in the header
+		extended uint8 // Upper 8 bits in the OPT TTL
+	}{
+		{DNSResponseCodeType.NoError, 0, 0},
+		{DNSResponseCodeType.NameError, 3, 0},
+		{DNSResponseCodeType.BadVersion, 0, 1},
+		{DNSResponseCodeType.BadCookie, 7, 1},
+		{DNSResponseCode(0xFFF), 0xF, 0xFF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rcode.String(), func(t *testing.T) {
+			packet := DNSPacket{
+				Header:     DNSHeader{ID: 1, QR: 1, RCODE: tt.rcode, ARCOUNT: 1},
+				Additional: []DNSRecord{OPTRecord{Name: RootName, UDPSize: 1232}},
+			}
+			buf, err := packet.ToBytes()
+			if err != nil {
+				t.Fatalf("ToBytes() error = %v", err)
+			}
+			if got := buf[3] & 0x0F; got != tt.header {
+				t.Errorf("header RCODE bits = %d, want %d", got, tt.header)
+			}
+			// The OPT record starts right after the header: root name, type,
+			// class, then the TTL whose first byte is the extended RCODE.
+			if got := buf[12+1+2+2]; got != tt.extended {
+				t.Errorf("OPT extended RCODE = %d, want %d", got, tt.extended)
+			}
+
+			parsed, err := ParseDNSPacket(buf, len(buf))
+			if err != nil {
+				t.Fatalf("ParseDNSPacket() error = %v", err)
+			}
+			if parsed.Header.RCODE != tt.rcode {
+				t.Errorf("parsed RCODE = %s, want %s", parsed.Header.RCODE, tt.rcode)
+			}
+		})
+	}
+}
+
+func TestExtendedRCODENeedsOPT(t *testing.T) {
+	packet := DNSPacket{Header: DNSHeader{ID: 1, QR: 1, RCODE: DNSResponseCodeType.BadVersion}}
+	if _, err := packet.ToBytes(); err == nil {
+		t.Error("BADVERS encoded without an OPT record")
+	}
+
+	// Without an OPT record only the header bits count.
+	packet.Header.RCODE = DNSResponseCodeType.Refused
+	buf, err := packet.ToBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseDNSPacket(buf, len(buf))
+	if err != nil || parsed.Header.RCODE != DNSResponseCodeType.Refused {
+		t.Errorf("parsed RCODE = %v, %v, want REFUSED", parsed.Header.RCODE, err)
+	}
+}
@@ -6,14 +6,17 @@ import (
 )
 
 type DNSQuestion struct {
-	Domain string
+	Domain Name
 	Type   RecordType
 	Class  Class
 }
 
-func (q *DNSQuestion) ToBytes(offsetMap map[string]uint, offSet uint) []byte {
+func (q *DNSQuestion) ToBytes(offsetMap map[string]uint, offSet uint) ([]byte, error) {
 	// Encoding the domain name
-	buf := encodeDomainName(q.Domain, offsetMap, offSet)
+	buf, err := encodeDomainName(q.Domain, offsetMap, offSet)
+	if err != nil {
+		return nil, err
+	}
 
 	typeBytes := make([]byte, 2)
 	classBytes := make([]byte, 2)
@@ -22,7 +25,7 @@ func (q *DNSQuestion) ToBytes(offsetMap map[string]uint, offSet uint) []byte {
 
 	buf = append(buf, typeBytes...)
 	buf = append(buf, classBytes...)
-	return buf
+	return buf, nil
 }
 
 func (q DNSQuestion) String() string {
@@ -8,14 +8,17 @@ import (
 )
 
 type DNSRecordPreamble struct {
-	Name  string
+	Name  Name
 	Type  RecordType
 	Class Class
 	TTL   uint32
 }
 
 func (a DNSRecordPreamble) ToBytes(offsetMap map[string]uint, offSet uint) ([]byte, error) {
-	buf := encodeDomainName(a.Name, offsetMap, offSet)
+	buf, err := encodeDomainName(a.Name, offsetMap, offSet)
+	if err != nil {
+		return nil, err
+	}
 
 	typeBytes := make([]byte, 2)
 	classBytes := make([]byte, 2)
@@ -35,7 +38,7 @@ func (a DNSRecordPreamble) ToBytes(offsetMap map[string]uint, offSet uint) ([]by
 
 func (a DNSRecordPreamble) String() string {
 	return "DNS RecordType:\n" +
-		"\tName: " + a.Name + "\n" +
+		"\tName: " + a.Name.String() + "\n" +
 		"\tType: " + a.Type.String() + "\n" +
 		"\tClass: " + a.Class.String() + "\n" +
 		"\tTTL: " + fmt.Sprint(a.TTL)
@@ -87,7 +90,7 @@ func (r ADNSRecord) String() string {
 
 type NSDNSRecord struct {
 	DNSRecordPreamble
-	Host string
+	Host Name
 }
 
 func (r NSDNSRecord) Preamble() DNSRecordPreamble {
@@ -100,7 +103,10 @@ func (r NSDNSRecord) ToBytes(offsetMap map[string]uint, offSet uint) ([]byte, er
 		return nil, err
 	}
 
-	rData := encodeDomainName(r.Host, offsetMap, offSet+uint(len(buf))+2) // +2 for rdLength
+	rData, err := encodeDomainName(r.Host, offsetMap, offSet+uint(len(buf))+2) // +2 for rdLength
+	if err != nil {
+		return nil, err
+	}
 
 	rdLengthBytes := make([]byte, 2)
 	binary.BigEndian.PutUint16(rdLengthBytes, uint16(len(rData)))
@@ -113,13 +119,13 @@ func (r NSDNSRecord) ToBytes(offsetMap map[string]uint, offSet uint) ([]byte, er
 
 func (r NSDNSRecord) String() string {
 	return r.DNSRecordPreamble.String() + "\n" +
-		"\tHost: " + r.Host
+		"\tHost: " + r.Host.String()
 }
 
 // CNAMERecord represents a DNS record of type CNAME (Canonical Name).
 type CNAMERecord struct {
 	DNSRecordPreamble
-	CanonicalName string
+	CanonicalName Name
 }
 
 func (r CNAMERecord) Preamble() DNSRecordPreamble {
@@ -132,7 +138,10 @@ func (r CNAMERecord) ToBytes(offsetMap map[string]uint, offSet uint) ([]byte, er
 		return nil, err
 	}
 
-	rData := encodeDomainName(r.CanonicalName, offsetMap, offSet+uint(len(buf))+2) // +2 for rdLength
+	rData, err := encodeDomainName(r.CanonicalName, offsetMap, offSet+uint(len(buf))+2) // +2 for rdLength
+	if err != nil {
+		return nil, err
+	}
 
 	rdLengthBytes := make([]byte, 2)
 	binary.BigEndian.PutUint16(rdLengthBytes, uint16(len(rData)))
@@ -145,7 +154,60 @@ func (r CNAMERecord) ToBytes(offsetMap map[string]uint, offSet uint) ([]byte, er
 
 func (r CNAMERecord) String() string {
 	return r.DNSRecordPreamble.String() + "\n" +
-		"\tCanonical Name: " + r.CanonicalName
+		"\tCanonical Name: " + r.CanonicalName.String()
+}
+
+// DNAMERecord represents a DNS record of type DNAME (RFC 6672), which
+// redirects every name below its owner to the same name below Target.
+type DNAMERecord struct {
+	DNSRecordPreamble
+	Target Name
+}
+
+func (r DNAMERecord) Preamble() DNSRecordPreamble {
+	return r.DNSRecordPreamble
+}
+
+func (r DNAMERecord) ToBytes(offsetMap map[string]uint, offSet uint) ([]byte, error) {
+	buf, err := r.DNSRecordPreamble.ToBytes(offsetMap, offSet)
+	if err != nil {
+		return nil, err
+	}
+
+	// The target must not be compressed (RFC 6672 section 2.5).
+	rData, err := encodeDomainName(r.Target, make(map[string]uint), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	rdLengthBytes := make([]byte, 2)
+	binary.BigEndian.PutUint16(rdLengthBytes, uint16(len(rData)))
+
+	buf = append(buf, rdLengthBytes...)
+	buf = append(buf, rData...)
+
+	return buf, nil
+}
+
+func (r DNAMERecord) String() string {
+	return r.DNSRecordPreamble.String() + "\n" +
+		"\tTarget: " + r.Target.String()
+}
+
+// SubstituteDNAME returns the name that name is redirected to by the DNAME
+// record: the part of name below the record's owner followed by its target.
+// It fails when name is not below the owner or the result is too long.
+func (r DNAMERecord) SubstituteDNAME(name Name) (Name, error) {
+	if !name.IsSubdomainOf(r.Name) || name.Equal(r.Name) {
+		return "", fmt.Errorf("%s is not below the DNAME owner %s", name, r.Name)
+	}
+	labels := name.rawLabels()
+	prefix := labels[:len(labels)-r.Name.CountLabels()]
+	synthesized := nameFromRawLabels(append(prefix, r.Target.rawLabels()...))
+	if _, err := encodeDomainName(synthesized, make(map[string]uint), 0); err != nil {
+		return "", err
+	}
+	return synthesized, nil
 }
 
 // TXTRecord represents a DNS record of type TXT (Text).
@@ -184,7 +246,7 @@ func (r TXTRecord) String() string {
 type MXRecord struct {
 	DNSRecordPreamble
 	Preference uint16
-	Exchange   string
+	Exchange   Name
 }
 
 func (r MXRecord) Preamble() DNSRecordPreamble {
@@ -200,7 +262,10 @@ func (r MXRecord) ToBytes(offsetMap map[string]uint, offSet uint) ([]byte, error
 	preferenceBytes := make([]byte, 2)
 	binary.BigEndian.PutUint16(preferenceBytes, r.Preference)
 
-	rData := encodeDomainName(r.Exchange, offsetMap, offSet+uint(len(buf)+len(preferenceBytes))+2) // +2 for rdLength
+	rData, err := encodeDomainName(r.Exchange, offsetMap, offSet+uint(len(buf)+len(preferenceBytes))+2) // +2 for rdLength
+	if err != nil {
+		return nil, err
+	}
 
 	rdLengthBytes := make([]byte, 2)
 	binary.BigEndian.PutUint16(rdLengthBytes, uint16(len(preferenceBytes)+len(rData)))
@@ -215,7 +280,7 @@ func (r MXRecord) ToBytes(offsetMap map[string]uint, offSet uint) ([]byte, error
 func (r MXRecord) String() string {
 	return r.DNSRecordPreamble.String() + "\n" +
 		"\tPreference: " + fmt.Sprint(r.Preference) + "\n" +
-		"\tExchange: " + r.Exchange
+		"\tExchange: " + r.Exchange.String()
 }
 
 // AAAARecord represents a DNS record of type AAAA (IPv6 Address).
@@ -256,8 +321,8 @@ func (r AAAARecord) String() string {
 // SOARecord represents a DNS record of type SOA (Start of Authority).
 type SOARecord struct {
 	DNSRecordPreamble
-	MName      string // Primary name server
-	RName      string // Responsible person
+	MName      Name   // Primary name server
+	RName      Name   // Responsible person
 	Serial     uint32 // Serial number
 	Refresh    uint32 // Refresh interval
 	Retry      uint32 // Retry interval
@@ -275,8 +340,14 @@ func (r SOARecord) ToBytes(offsetMap map[string]uint, offSet uint) ([]byte, erro
 		return nil, err
 	}
 
-	mNameData := encodeDomainName(r.MName, offsetMap, offSet+uint(len(buf))+2)                // +2 for rdLength
-	rNameData := encodeDomainName(r.RName, offsetMap, offSet+uint(len(buf)+len(mNameData))+2) // +2 for rdLength
+	mNameData, err := encodeDomainName(r.MName, offsetMap, offSet+uint(len(buf))+2) // +2 for rdLength
+	if err != nil {
+		return nil, err
+	}
+	rNameData, err := encodeDomainName(r.RName, offsetMap, offSet+uint(len(buf)+len(mNameData))+2) // +2 for rdLength
+	if err != nil {
+		return nil, err
+	}
 
 	rdLengthBytes := make([]byte, 2)
 	binary.BigEndian.PutUint16(rdLengthBytes, uint16(len(mNameData)+len(rNameData)+20))
@@ -286,19 +357,21 @@ func (r SOARecord) ToBytes(offsetMap map[string]uint, offSet uint) ([]byte, erro
 	buf = append(buf, rNameData...)
 
 	// Append the numeric fields
-	binary.BigEndian.PutUint32(buf, r.Serial)
-	binary.BigEndian.PutUint32(buf[4:], r.Refresh)
-	binary.BigEndian.PutUint32(buf[8:], r.Retry)
-	binary.BigEndian.PutUint32(buf[12:], r.Expire)
-	binary.BigEndian.PutUint32(buf[16:], r.MinimumTTL)
+	numbers := make([]byte, 20)
+	binary.BigEndian.PutUint32(numbers, r.Serial)
+	binary.BigEndian.PutUint32(numbers[4:], r.Refresh)
+	binary.BigEndian.PutUint32(numbers[8:], r.Retry)
+	binary.BigEndian.PutUint32(numbers[12:], r.Expire)
+	binary.BigEndian.PutUint32(numbers[16:], r.MinimumTTL)
+	buf = append(buf, numbers...)
 
 	return buf, nil
 }
 
 func (r SOARecord) String() string {
 	return r.DNSRecordPreamble.String() + "\n" +
-		"\tMName: " + r.MName + "\n" +
-		"\tRName: " + r.RName + "\n" +
+		"\tMName: " + r.MName.String() + "\n" +
+		"\tRName: " + r.RName.String() + "\n" +
 		"\tSerial: " + fmt.Sprint(r.Serial) + "\n" +
 		"\tRefresh: " + fmt.Sprint(r.Refresh) + "\n" +
 		"\tRetry: " + fmt.Sprint(r.Retry) + "\n" +
@@ -309,7 +382,7 @@ func (r SOARecord) String() string {
 // PTRRecord represents a DNS record of type PTR (Pointer).
 type PTRRecord struct {
 	DNSRecordPreamble
-	Pointer string // Domain name to which the PTR record points
+	Pointer Name // Domain name to which the PTR record points
 }
 
 func (r PTRRecord) Preamble() DNSRecordPreamble {
@@ -322,7 +395,10 @@ func (r PTRRecord) ToBytes(offsetMap map[string]uint, offSet uint) ([]byte, erro
 		return nil, err
 	}
 
-	rData := encodeDomainName(r.Pointer, offsetMap, offSet+uint(len(buf))+2) // +2 for rdLength
+	rData, err := encodeDomainName(r.Pointer, offsetMap, offSet+uint(len(buf))+2) // +2 for rdLength
+	if err != nil {
+		return nil, err
+	}
 
 	rdLengthBytes := make([]byte, 2)
 	binary.BigEndian.PutUint16(rdLengthBytes, uint16(len(rData)))
@@ -335,7 +411,38 @@ func (r PTRRecord) ToBytes(offsetMap map[string]uint, offSet uint) ([]byte, erro
 
 func (r PTRRecord) String() string {
 	return r.DNSRecordPreamble.String() + "\n" +
-		"\tPointer: " + r.Pointer
+		"\tPointer: " + r.Pointer.String()
+}
+
+// UnknownRecord holds a record of a type this package does not decode, with
+// its RDATA kept as is (RFC 3597).
+type UnknownRecord struct {
+	DNSRecordPreamble
+	Data []byte
+}
+
+func (r UnknownRecord) Preamble() DNSRecordPreamble {
+	return r.DNSRecordPreamble
+}
+
+func (r UnknownRecord) ToBytes(offsetMap map[string]uint, offSet uint) ([]byte, error) {
+	buf, err := r.DNSRecordPreamble.ToBytes(offsetMap, offSet)
+	if err != nil {
+		return nil, err
+	}
+
+	rdLengthBytes := make([]byte, 2)
+	binary.BigEndian.PutUint16(rdLengthBytes, uint16(len(r.Data)))
+
+	buf = append(buf, rdLengthBytes...)
+	buf = append(buf, r.Data...)
+
+	return buf, nil
+}
+
+func (r UnknownRecord) String() string {
+	return r.DNSRecordPreamble.String() + "\n" +
+		fmt.Sprintf("\tData: \\# %d %x", len(r.Data), r.Data)
 }
 
 // SPFRecord represents a DNS record of type SPF (Sender Policy Framework).
@@ -343,14 +450,16 @@ type SPFRecord struct {
 	TXTRecord
 }
 
-// OPTRecord represents a DNS record of type OPT (EDNS0).
+// EDNSOption is a single option in the RDATA of an OPT record. Use Decode to
+// get its typed form.
 type EDNSOption struct {
-	Code uint16
+	Code EDNSOptionCode
 	Data []byte
 }
 
+// OPTRecord represents a DNS record of type OPT (EDNS0).
 type OPTRecord struct {
-	Name     string       // Name is always empty for OPT records
+	Name     Name         // Name is always empty for OPT records
 	UDPSize  uint16       // UDPSize is the maximum size of the UDP payload
 	ExtRCODE uint8        // Extended response code
 	Version  uint8        // Version of the EDNS0 protocol
@@ -382,7 +491,7 @@ func (r OPTRecord) ToBytes(offsetMap map[string]uint, offSet uint) ([]byte, erro
 	rdata := make([]byte, 0)
 	for _, option := range r.Options {
 		optionData := make([]byte, 4+len(option.Data))
-		binary.BigEndian.PutUint16(optionData[:2], option.Code)
+		binary.BigEndian.PutUint16(optionData[:2], uint16(option.Code))
 		binary.BigEndian.PutUint16(optionData[2:4], uint16(len(option.Data)))
 		copy(optionData[4:], option.Data)
 		rdata = append(rdata, optionData...)
@@ -404,9 +513,7 @@ func (r OPTRecord) String() string {
 	str += fmt.Sprintf("\tZ: %d\n", r.Z)
 	if len(r.Options) > 0 {
 		str += "\tOptions:\n"
-		for _, opt := range r.Options {
-			str += fmt.Sprintf("\t\tCode: %d, Data: % x\n", opt.Code, opt.Data)
-		}
+		str += optionsString(r.Options)
 	} else {
 		str += "\tOptions: none\n"
 	}
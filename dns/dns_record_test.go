@@ -0,0 +1,54 @@
+package dns
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSubstituteDNAME(t *testing.T) {
+	record := DNAMERecord{DNSRecordPreamble: DNSRecordPreamble{Name: "Example.COM.", Type: RType.DNAME, Class: ClassType.IN}, Target: "example.net."}
+	long := Name(strings.Repeat("x", 63) + "." + strings.Repeat("x", 63) + "." + strings.Repeat("x", 63) + "." + strings.Repeat("x", 60) + ".")
+	tests := []struct {
+		name    string
+		record  DNAMERecord
+		query   Name
+		want    Name
+		wantErr bool
+	}{
+		{"one label below", record, "www.example.com.", "www.example.net.", false},
+		{"several labels below", record, "a.B.example.com.", "a.B.example.net.", false},
+		{"escaped label", record, `a\.b.example.com.`, `a\.b.example.net.`, false},
+		{"owner itself", record, "example.com.", "", true},
+		{"outside the owner", record, "www.example.org.", "", true},
+		{"to the root", DNAMERecord{DNSRecordPreamble: record.DNSRecordPreamble, Target: RootName}, "www.example.com.", "www.", false},
+		{"too long", DNAMERecord{DNSRecordPreamble: record.DNSRecordPreamble, Target: long}, "abcdefgh.example.com.", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.record.SubstituteDNAME(tt.query)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SubstituteDNAME(%s) error = %v, wantErr %v", tt.query, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("SubstituteDNAME(%s) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDNAMERoundTrip(t *testing.T) {
+	record := DNAMERecord{DNSRecordPreamble: DNSRecordPreamble{Name: "example.com.", Type: RType.DNAME, Class: ClassType.IN, TTL: 60}, Target: "example.com.example.net."}
+	packet := DNSPacket{Header: DNSHeader{ID: 1, QR: 1, ANCOUNT: 1}, Answers: []DNSRecord{record}}
+	buf, err := packet.ToBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseDNSPacket(buf, len(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := parsed.Answers[0].(DNAMERecord)
+	if !ok || got.Name != record.Name || got.Target != record.Target || got.TTL != record.TTL {
+		t.Errorf("parsed %v, want %v", parsed.Answers[0], record)
+	}
+}
@@ -0,0 +1,96 @@
+package dns
+
+import "fmt"
+
+// ExtendedErrorCode is an INFO-CODE of an Extended DNS Error (RFC 8914).
+type ExtendedErrorCode uint16
+
+var EDECodeType = struct {
+	Other                      ExtendedErrorCode
+	UnsupportedDNSKEYAlgorithm ExtendedErrorCode
+	UnsupportedDSDigestType    ExtendedErrorCode
+	StaleAnswer                ExtendedErrorCode
+	ForgedAnswer               ExtendedErrorCode
+	DNSSECIndeterminate        ExtendedErrorCode
+	DNSSECBogus                ExtendedErrorCode
+	SignatureExpired           ExtendedErrorCode
+	SignatureNotYetValid       ExtendedErrorCode
+	DNSKEYMissing              ExtendedErrorCode
+	RRSIGsMissing              ExtendedErrorCode
+	NoZoneKeyBitSet            ExtendedErrorCode
+	NSECMissing                ExtendedErrorCode
+	CachedError                ExtendedErrorCode
+	NotReady                   ExtendedErrorCode
+	Blocked                    ExtendedErrorCode
+	Censored                   ExtendedErrorCode
+	Filtered                   ExtendedErrorCode
+	Prohibited                 ExtendedErrorCode
+	StaleNXDomainAnswer        ExtendedErrorCode
+	NotAuthoritative           ExtendedErrorCode
+	NotSupported               ExtendedErrorCode
+	NoReachableAuthority       ExtendedErrorCode
+	NetworkError               ExtendedErrorCode
+	InvalidData                ExtendedErrorCode
+}{
+	Other:                      0,
+	UnsupportedDNSKEYAlgorithm: 1,
+	UnsupportedDSDigestType:    2,
+	StaleAnswer:                3,
+	ForgedAnswer:               4,
+	DNSSECIndeterminate:        5,
+	DNSSECBogus:                6,
+	SignatureExpired:           7,
+	SignatureNotYetValid:       8,
+	DNSKEYMissing:              9,
+	RRSIGsMissing:              10,
+	NoZoneKeyBitSet:            11,
+	NSECMissing:                12,
+	CachedError:                13,
+	NotReady:                   14,
+	Blocked:                    15,
+	Censored:                   16,
+	Filtered:                   17,
+	Prohibited:                 18,
+	StaleNXDomainAnswer:        19,
+	NotAuthoritative:           20,
+	NotSupported:               21,
+	NoReachableAuthority:       22,
+	NetworkError:               23,
+	InvalidData:                24,
+}
+
+var EDECodeName = map[ExtendedErrorCode]string{
+	EDECodeType.Other:                      "Other Error",
+	EDECodeType.UnsupportedDNSKEYAlgorithm: "Unsupported DNSKEY Algorithm",
+	EDECodeType.UnsupportedDSDigestType:    "Unsupported DS Digest Type",
+	EDECodeType.StaleAnswer:                "Stale Answer",
+	EDECodeType.ForgedAnswer:               "Forged Answer",
+	EDECodeType.DNSSECIndeterminate:        "DNSSEC Indeterminate",
+	EDECodeType.DNSSECBogus:                "DNSSEC Bogus",
+	EDECodeType.SignatureExpired:           "Signature Expired",
+	EDECodeType.SignatureNotYetValid:       "Signature Not Yet Valid",
+	EDECodeType.DNSKEYMissing:              "DNSKEY Missing",
+	EDECodeType.RRSIGsMissing:              "RRSIGs Missing",
+	EDECodeType.NoZoneKeyBitSet:            "No Zone Key Bit Set",
+	EDECodeType.NSECMissing:                "NSEC Missing",
+	EDECodeType.CachedError:                "Cached Error",
+	EDECodeType.NotReady:                   "Not Ready",
+	EDECodeType.Blocked:                    "Blocked",
+	EDECodeType.Censored:                   "Censored",
+	EDECodeType.Filtered:                   "Filtered",
+	EDECodeType.Prohibited:                 "Prohibited",
+	EDECodeType.StaleNXDomainAnswer:        "Stale NXDomain Answer",
+	EDECodeType.NotAuthoritative:           "Not Authoritative",
+	EDECodeType.NotSupported:               "Not Supported",
+	EDECodeType.NoReachableAuthority:       "No Reachable Authority",
+	EDECodeType.NetworkError:               "Network Error",
+	EDECodeType.InvalidData:                "Invalid Data",
+}
+
+func (c ExtendedErrorCode) String() string {
+	val, ok := EDECodeName[c]
+	if ok {
+		return val
+	}
+	return fmt.Sprintf("%d", uint16(c))
+}
@@ -0,0 +1,468 @@
+package dns
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+	"unicode"
+)
+
+type EDNSOptionCode uint16
+
+var EDNSOptionCodeType = struct {
+	NSID          EDNSOptionCode
+	ClientSubnet  EDNSOptionCode
+	Cookie        EDNSOptionCode
+	TCPKeepalive  EDNSOptionCode
+	Padding       EDNSOptionCode
+	ExtendedError EDNSOptionCode
+}{
+	NSID:          3,
+	ClientSubnet:  8,
+	Cookie:        10,
+	TCPKeepalive:  11,
+	Padding:       12,
+	ExtendedError: 15,
+}
+
+var EDNSOptionName = map[EDNSOptionCode]string{
+	EDNSOptionCodeType.NSID:          "NSID",
+	EDNSOptionCodeType.ClientSubnet:  "ECS",
+	EDNSOptionCodeType.Cookie:        "COOKIE",
+	EDNSOptionCodeType.TCPKeepalive:  "TCP-KEEPALIVE",
+	EDNSOptionCodeType.Padding:       "PADDING",
+	EDNSOptionCodeType.ExtendedError: "EDE",
+}
+
+func (c EDNSOptionCode) String() string {
+	val, ok := EDNSOptionName[c]
+	if ok {
+		return val
+	}
+	return fmt.Sprintf("%d", uint16(c))
+}
+
+// EDNSOptionValue is implemented by the typed EDNS options. Pack returns the
+// option data without the code and length prefix.
+type EDNSOptionValue interface {
+	OptionCode() EDNSOptionCode
+	Pack() ([]byte, error)
+	String() string
+}
+
+// Decode returns the typed form of a raw option.
+func (o EDNSOption) Decode() (EDNSOptionValue, error) {
+	switch o.Code {
+	case EDNSOptionCodeType.NSID:
+		return ParseNSIDOption(o.Data)
+	case EDNSOptionCodeType.ClientSubnet:
+		return ParseClientSubnetOption(o.Data)
+	case EDNSOptionCodeType.Cookie:
+		return ParseCookieOption(o.Data)
+	case EDNSOptionCodeType.TCPKeepalive:
+		return ParseKeepaliveOption(o.Data)
+	case EDNSOptionCodeType.Padding:
+		return ParsePaddingOption(o.Data)
+	case EDNSOptionCodeType.ExtendedError:
+		return ParseExtendedErrorOption(o.Data)
+	default:
+		return nil, fmt.Errorf("unsupported EDNS option %s", o.Code)
+	}
+}
+
+func (o EDNSOption) String() string {
+	if value, err := o.Decode(); err == nil {
+		return value.String()
+	}
+	return fmt.Sprintf("Code: %s, Data: % x", o.Code, o.Data)
+}
+
+// Option returns the first option with the given code.
+func (r OPTRecord) Option(code EDNSOptionCode) (EDNSOption, bool) {
+	for _, option := range r.Options {
+		if option.Code == code {
+			return option, true
+		}
+	}
+	return EDNSOption{}, false
+}
+
+// SetOption encodes value and stores it in the record, replacing any option
+// with the same code.
+func (r *OPTRecord) SetOption(value EDNSOptionValue) error {
+	data, err := value.Pack()
+	if err != nil {
+		return err
+	}
+	option := EDNSOption{Code: value.OptionCode(), Data: data}
+	for i := range r.Options {
+		if r.Options[i].Code == option.Code {
+			r.Options[i] = option
+			return nil
+		}
+	}
+	r.Options = append(r.Options, option)
+	return nil
+}
+
+// RemoveOption drops every option with the given code.
+func (r *OPTRecord) RemoveOption(code EDNSOptionCode) {
+	options := r.Options[:0]
+	for _, option := range r.Options {
+		if option.Code != code {
+			options = append(options, option)
+		}
+	}
+	r.Options = options
+}
+
+// NSID returns the name server identifier option, or nil if there is none.
+func (r OPTRecord) NSID() (*NSIDOption, error) {
+	option, ok := r.Option(EDNSOptionCodeType.NSID)
+	if !ok {
+		return nil, nil
+	}
+	nsid, err := ParseNSIDOption(option.Data)
+	if err != nil {
+		return nil, err
+	}
+	return &nsid, nil
+}
+
+// ClientSubnet returns the EDNS Client Subnet option, or nil if there is none.
+func (r OPTRecord) ClientSubnet() (*ClientSubnetOption, error) {
+	option, ok := r.Option(EDNSOptionCodeType.ClientSubnet)
+	if !ok {
+		return nil, nil
+	}
+	subnet, err := ParseClientSubnetOption(option.Data)
+	if err != nil {
+		return nil, err
+	}
+	return &subnet, nil
+}
+
+// Cookie returns the DNS Cookie option, or nil if there is none.
+func (r OPTRecord) Cookie() (*CookieOption, error) {
+	option, ok := r.Option(EDNSOptionCodeType.Cookie)
+	if !ok {
+		return nil, nil
+	}
+	cookie, err := ParseCookieOption(option.Data)
+	if err != nil {
+		return nil, err
+	}
+	return &cookie, nil
+}
+
+// Keepalive returns the TCP Keepalive option, or nil if there is none.
+func (r OPTRecord) Keepalive() (*KeepaliveOption, error) {
+	option, ok := r.Option(EDNSOptionCodeType.TCPKeepalive)
+	if !ok {
+		return nil, nil
+	}
+	keepalive, err := ParseKeepaliveOption(option.Data)
+	if err != nil {
+		return nil, err
+	}
+	return &keepalive, nil
+}
+
+// Padding returns the Padding option, or nil if there is none.
+func (r OPTRecord) Padding() (*PaddingOption, error) {
+	option, ok := r.Option(EDNSOptionCodeType.Padding)
+	if !ok {
+		return nil, nil
+	}
+	padding, err := ParsePaddingOption(option.Data)
+	if err != nil {
+		return nil, err
+	}
+	return &padding, nil
+}
+
+// ExtendedError returns the Extended DNS Error option, or nil if there is none.
+func (r OPTRecord) ExtendedError() (*ExtendedErrorOption, error) {
+	option, ok := r.Option(EDNSOptionCodeType.ExtendedError)
+	if !ok {
+		return nil, nil
+	}
+	ede, err := ParseExtendedErrorOption(option.Data)
+	if err != nil {
+		return nil, err
+	}
+	return &ede, nil
+}
+
+// NSIDOption carries the name server identifier (RFC 5001). Queries send it
+// empty to ask the server to identify itself.
+type NSIDOption struct {
+	ID []byte
+}
+
+func ParseNSIDOption(data []byte) (NSIDOption, error) {
+	return NSIDOption{ID: append([]byte(nil), data...)}, nil
+}
+
+func (o NSIDOption) OptionCode() EDNSOptionCode {
+	return EDNSOptionCodeType.NSID
+}
+
+func (o NSIDOption) Pack() ([]byte, error) {
+	return append([]byte(nil), o.ID...), nil
+}
+
+func (o NSIDOption) String() string {
+	if len(o.ID) == 0 {
+		return "NSID: requested"
+	}
+	printable := true
+	for _, b := range o.ID {
+		if b > unicode.MaxASCII || !unicode.IsPrint(rune(b)) {
+			printable = false
+			break
+		}
+	}
+	if printable {
+		return fmt.Sprintf("NSID: %s (%q)", hex.EncodeToString(o.ID), string(o.ID))
+	}
+	return "NSID: " + hex.EncodeToString(o.ID)
+}
+
+// ClientSubnetOption carries the EDNS Client Subnet option (RFC 7871).
+type ClientSubnetOption struct {
+	Family       uint16 // 1 for IPv4, 2 for IPv6
+	SourcePrefix uint8  // Leftmost bits of Address that are significant
+	ScopePrefix  uint8  // Set by servers, must be zero in queries
+	Address      net.IP
+}
+
+const (
+	ClientSubnetFamilyIPv4 uint16 = 1
+	ClientSubnetFamilyIPv6 uint16 = 2
+)
+
+func ParseClientSubnetOption(data []byte) (ClientSubnetOption, error) {
+	if len(data) < 4 {
+		return ClientSubnetOption{}, errors.New("ECS option too short")
+	}
+	o := ClientSubnetOption{
+		Family:       binary.BigEndian.Uint16(data[0:2]),
+		SourcePrefix: data[2],
+		ScopePrefix:  data[3],
+	}
+
+	var size int
+	switch o.Family {
+	case ClientSubnetFamilyIPv4:
+		size = net.IPv4len
+	case ClientSubnetFamilyIPv6:
+		size = net.IPv6len
+	default:
+		return ClientSubnetOption{}, fmt.Errorf("unknown ECS address family %d", o.Family)
+	}
+	if int(o.SourcePrefix) > size*8 || int(o.ScopePrefix) > size*8 {
+		return ClientSubnetOption{}, errors.New("ECS prefix longer than the address")
+	}
+
+	address := data[4:]
+	if len(address) != (int(o.SourcePrefix)+7)/8 {
+		return ClientSubnetOption{}, errors.New("ECS address length does not match the source prefix")
+	}
+	o.Address = make(net.IP, size)
+	copy(o.Address, address)
+	if !o.Address.Mask(net.CIDRMask(int(o.SourcePrefix), size*8)).Equal(o.Address) {
+		return ClientSubnetOption{}, errors.New("ECS address has bits set beyond the source prefix")
+	}
+	return o, nil
+}
+
+func (o ClientSubnetOption) OptionCode() EDNSOptionCode {
+	return EDNSOptionCodeType.ClientSubnet
+}
+
+func (o ClientSubnetOption) Pack() ([]byte, error) {
+	var address net.IP
+	switch o.Family {
+	case ClientSubnetFamilyIPv4:
+		address = o.Address.To4()
+	case ClientSubnetFamilyIPv6:
+		address = o.Address.To16()
+	default:
+		return nil, fmt.Errorf("unknown ECS address family %d", o.Family)
+	}
+	if address == nil {
+		return nil, errors.New("ECS address does not match its family")
+	}
+	if int(o.SourcePrefix) > len(address)*8 || int(o.ScopePrefix) > len(address)*8 {
+		return nil, errors.New("ECS prefix longer than the address")
+	}
+
+	masked := address.Mask(net.CIDRMask(int(o.SourcePrefix), len(address)*8))
+	buf := make([]byte, 4, 4+len(masked))
+	binary.BigEndian.PutUint16(buf[0:2], o.Family)
+	buf[2] = o.SourcePrefix
+	buf[3] = o.ScopePrefix
+	return append(buf, masked[:(int(o.SourcePrefix)+7)/8]...), nil
+}
+
+func (o ClientSubnetOption) String() string {
+	return fmt.Sprintf("ECS: %s/%d/%d", o.Address, o.SourcePrefix, o.ScopePrefix)
+}
+
+// CookieOption carries a DNS Cookie (RFC 7873). The client cookie is always
+// 8 bytes; the server cookie is empty on the first query and 8 to 32 bytes
+// afterwards.
+type CookieOption struct {
+	Client []byte
+	Server []byte
+}
+
+func ParseCookieOption(data []byte) (CookieOption, error) {
+	if len(data) != 8 && (len(data) < 16 || len(data) > 40) {
+		return CookieOption{}, fmt.Errorf("invalid cookie length %d", len(data))
+	}
+	return CookieOption{
+		Client: append([]byte(nil), data[:8]...),
+		Server: append([]byte(nil), data[8:]...),
+	}, nil
+}
+
+func (o CookieOption) OptionCode() EDNSOptionCode {
+	return EDNSOptionCodeType.Cookie
+}
+
+func (o CookieOption) Pack() ([]byte, error) {
+	if len(o.Client) != 8 {
+		return nil, errors.New("client cookie must be 8 bytes")
+	}
+	if len(o.Server) != 0 && (len(o.Server) < 8 || len(o.Server) > 32) {
+		return nil, errors.New("server cookie must be between 8 and 32 bytes")
+	}
+	return append(append([]byte(nil), o.Client...), o.Server...), nil
+}
+
+func (o CookieOption) String() string {
+	if len(o.Server) == 0 {
+		return "COOKIE: client " + hex.EncodeToString(o.Client)
+	}
+	return "COOKIE: client " + hex.EncodeToString(o.Client) + ", server " + hex.EncodeToString(o.Server)
+}
+
+// KeepaliveOption carries the edns-tcp-keepalive option (RFC 7828). Clients
+// send it without a timeout; servers answer with the idle timeout they
+// allow, which is encoded in units of 100 milliseconds.
+type KeepaliveOption struct {
+	HasTimeout bool
+	Timeout    time.Duration
+}
+
+func ParseKeepaliveOption(data []byte) (KeepaliveOption, error) {
+	switch len(data) {
+	case 0:
+		return KeepaliveOption{}, nil
+	case 2:
+		timeout := time.Duration(binary.BigEndian.Uint16(data)) * 100 * time.Millisecond
+		return KeepaliveOption{HasTimeout: true, Timeout: timeout}, nil
+	default:
+		return KeepaliveOption{}, fmt.Errorf("invalid keepalive length %d", len(data))
+	}
+}
+
+func (o KeepaliveOption) OptionCode() EDNSOptionCode {
+	return EDNSOptionCodeType.TCPKeepalive
+}
+
+func (o KeepaliveOption) Pack() ([]byte, error) {
+	if !o.HasTimeout {
+		return []byte{}, nil
+	}
+	units := o.Timeout / (100 * time.Millisecond)
+	if units < 0 || units > 0xFFFF {
+		return nil, errors.New("keepalive timeout out of range")
+	}
+	buf := make([]byte, 2)
+	binary.BigEndian.PutUint16(buf, uint16(units))
+	return buf, nil
+}
+
+func (o KeepaliveOption) String() string {
+	if !o.HasTimeout {
+		return "TCP-KEEPALIVE: requested"
+	}
+	return "TCP-KEEPALIVE: " + o.Timeout.String()
+}
+
+// PaddingOption pads a message to hide its size (RFC 7830). Only the length
+// matters, the padding bytes are zero.
+type PaddingOption struct {
+	Length int
+}
+
+func ParsePaddingOption(data []byte) (PaddingOption, error) {
+	return PaddingOption{Length: len(data)}, nil
+}
+
+func (o PaddingOption) OptionCode() EDNSOptionCode {
+	return EDNSOptionCodeType.Padding
+}
+
+func (o PaddingOption) Pack() ([]byte, error) {
+	if o.Length < 0 || o.Length > 0xFFFF {
+		return nil, errors.New("padding length out of range")
+	}
+	return make([]byte, o.Length), nil
+}
+
+func (o PaddingOption) String() string {
+	return fmt.Sprintf("PADDING: %d bytes", o.Length)
+}
+
+// ExtendedErrorOption explains why a query failed (RFC 8914).
+type ExtendedErrorOption struct {
+	InfoCode  ExtendedErrorCode
+	ExtraText string // Free form UTF-8 text for humans, may be empty
+}
+
+func ParseExtendedErrorOption(data []byte) (ExtendedErrorOption, error) {
+	if len(data) < 2 {
+		return ExtendedErrorOption{}, errors.New("EDE option too short")
+	}
+	return ExtendedErrorOption{
+		InfoCode:  ExtendedErrorCode(binary.BigEndian.Uint16(data[0:2])),
+		ExtraText: strings.TrimRight(string(data[2:]), "\x00"),
+	}, nil
+}
+
+func (o ExtendedErrorOption) OptionCode() EDNSOptionCode {
+	return EDNSOptionCodeType.ExtendedError
+}
+
+func (o ExtendedErrorOption) Pack() ([]byte, error) {
+	if len(o.ExtraText) > 0xFFFF-2 {
+		return nil, errors.New("EDE extra text too long")
+	}
+	buf := make([]byte, 2, 2+len(o.ExtraText))
+	binary.BigEndian.PutUint16(buf, uint16(o.InfoCode))
+	return append(buf, o.ExtraText...), nil
+}
+
+func (o ExtendedErrorOption) String() string {
+	if o.ExtraText == "" {
+		return fmt.Sprintf("EDE: %d (%s)", uint16(o.InfoCode), o.InfoCode)
+	}
+	return fmt.Sprintf("EDE: %d (%s): %s", uint16(o.InfoCode), o.InfoCode, o.ExtraText)
+}
+
+// optionsString renders options one per line for OPTRecord.String.
+func optionsString(options []EDNSOption) string {
+	var sb strings.Builder
+	for _, opt := range options {
+		sb.WriteString("\t\t" + opt.String() + "\n")
+	}
+	return sb.String()
+}
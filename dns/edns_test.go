@@ -0,0 +1,145 @@
+package dns
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// roundTripOPT sends opt through ToBytes and ParseDNSPacket as the only
+// additional record of a response and returns the parsed OPT record.
+func roundTripOPT(t *testing.T, opt OPTRecord) OPTRecord {
+	t.Helper()
+	packet := DNSPacket{Header: DNSHeader{ID: 1, QR: 1, ARCOUNT: 1}, Additional: []DNSRecord{opt}}
+	buf, err := packet.ToBytes()
+	if err != nil {
+		t.Fatalf("ToBytes() error = %v", err)
+	}
+	parsed, err := ParseDNSPacket(buf, len(buf))
+	if err != nil {
+		t.Fatalf("ParseDNSPacket() error = %v", err)
+	}
+	parsedOPT, ok := parsed.Additional[0].(OPTRecord)
+	if !ok {
+		t.Fatalf("parsed %T instead of an OPT record", parsed.Additional[0])
+	}
+	return parsedOPT
+}
+
+func TestEDNSOptionRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		value EDNSOptionValue
+	}{
+		{"NSID request", NSIDOption{}},
+		{"NSID", NSIDOption{ID: []byte("ns1.fra")}},
+		{"ECS IPv4", ClientSubnetOption{Family: ClientSubnetFamilyIPv4, SourcePrefix: 24, Address: net.IPv4(192, 0, 2, 0).To4()}},
+		{"ECS IPv4 odd prefix", ClientSubnetOption{Family: ClientSubnetFamilyIPv4, SourcePrefix: 20, ScopePrefix: 16, Address: net.IPv4(192, 0, 16, 0).To4()}},
+		{"ECS IPv6", ClientSubnetOption{Family: ClientSubnetFamilyIPv6, SourcePrefix: 56, Address: net.ParseIP("2001:db8:1234:5600::")}},
+		{"ECS no address", ClientSubnetOption{Family: ClientSubnetFamilyIPv4, Address: net.IPv4zero.To4()}},
+		{"client cookie", CookieOption{Client: []byte{1, 2, 3, 4, 5, 6, 7, 8}}},
+		{"server cookie", CookieOption{Client: []byte{1, 2, 3, 4, 5, 6, 7, 8}, Server: []byte{9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24}}},
+		{"keepalive request", KeepaliveOption{}},
+		{"keepalive", KeepaliveOption{HasTimeout: true, Timeout: 12300 * time.Millisecond}},
+		{"padding", PaddingOption{Length: 37}},
+		{"EDE", ExtendedErrorOption{InfoCode: EDECodeType.NoReachableAuthority, ExtraText: "all nameservers timed out"}},
+		{"EDE without text", ExtendedErrorOption{InfoCode: EDECodeType.Blocked}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opt := OPTRecord{Name: RootName, UDPSize: 1232}
+			if err := opt.SetOption(tt.value); err != nil {
+				t.Fatalf("SetOption() error = %v", err)
+			}
+			parsed := roundTripOPT(t, opt)
+			if len(parsed.Options) != 1 {
+				t.Fatalf("parsed %d options, want 1", len(parsed.Options))
+			}
+			decoded, err := parsed.Options[0].Decode()
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if !reflect.DeepEqual(decoded, tt.value) {
+				t.Errorf("decoded %#v, want %#v", decoded, tt.value)
+			}
+		})
+	}
+}
+
+func TestEDNSOptionAccessors(t *testing.T) {
+	opt := OPTRecord{Name: RootName, UDPSize: 1232}
+	for _, value := range []EDNSOptionValue{
+		NSIDOption{ID: []byte("a")},
+		ExtendedErrorOption{InfoCode: EDECodeType.Other, ExtraText: "first"},
+		PaddingOption{Length: 4},
+		ExtendedErrorOption{InfoCode: EDECodeType.Censored, ExtraText: "replaced"},
+	} {
+		if err := opt.SetOption(value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(opt.Options) != 3 {
+		t.Errorf("SetOption kept %d options, want 3", len(opt.Options))
+	}
+	if ede, err := opt.ExtendedError(); err != nil || ede.InfoCode != EDECodeType.Censored {
+		t.Errorf("ExtendedError() = %v, %v, want the replacement", ede, err)
+	}
+	if cookie, err := opt.Cookie(); cookie != nil || err != nil {
+		t.Errorf("Cookie() = %v, %v, want none", cookie, err)
+	}
+	opt.RemoveOption(EDNSOptionCodeType.Padding)
+	if padding, _ := opt.Padding(); padding != nil {
+		t.Error("RemoveOption left the padding")
+	}
+}
+
+func TestEDNSOptionRejected(t *testing.T) {
+	tests := []struct {
+		name   string
+		option EDNSOption
+	}{
+		{"ECS too short", EDNSOption{Code: EDNSOptionCodeType.ClientSubnet, Data: []byte{0, 1, 24}}},
+		{"ECS unknown family", EDNSOption{Code: EDNSOptionCodeType.ClientSubnet, Data: []byte{0, 3, 0, 0}}},
+		{"ECS prefix too long", EDNSOption{Code: EDNSOptionCodeType.ClientSubnet, Data: []byte{0, 1, 33, 0, 1, 2, 3, 4, 5}}},
+		{"ECS address too long", EDNSOption{Code: EDNSOptionCodeType.ClientSubnet, Data: []byte{0, 1, 8, 0, 192, 0}}},
+		{"ECS bits past prefix", EDNSOption{Code: EDNSOptionCodeType.ClientSubnet, Data: []byte{0, 1, 4, 0, 0xFF}}},
+		{"cookie too short", EDNSOption{Code: EDNSOptionCodeType.Cookie, Data: make([]byte, 7)}},
+		{"server cookie too short", EDNSOption{Code: EDNSOptionCodeType.Cookie, Data: make([]byte, 12)}},
+		{"server cookie too long", EDNSOption{Code: EDNSOptionCodeType.Cookie, Data: make([]byte, 41)}},
+		{"keepalive odd length", EDNSOption{Code: EDNSOptionCodeType.TCPKeepalive, Data: []byte{1}}},
+		{"EDE too short", EDNSOption{Code: EDNSOptionCodeType.ExtendedError, Data: []byte{0}}},
+		{"unknown option", EDNSOption{Code: 65001, Data: []byte{1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if value, err := tt.option.Decode(); err == nil {
+				t.Errorf("Decode() = %v, want an error", value)
+			}
+		})
+	}
+}
+
+func TestOPTRoundTrip(t *testing.T) {
+	opt := OPTRecord{
+		Name:    RootName,
+		UDPSize: 4096,
+		Version: 0,
+		DO:      true,
+		Z:       0x1234,
+		Options: []EDNSOption{{Code: 65001, Data: []byte{1, 2, 3}}, {Code: EDNSOptionCodeType.Padding, Data: []byte{}}},
+	}
+	parsed := roundTripOPT(t, opt)
+	if parsed.UDPSize != opt.UDPSize || parsed.DO != opt.DO || parsed.Z != opt.Z || parsed.Version != opt.Version {
+		t.Errorf("parsed %s, want %s", parsed, opt)
+	}
+	if len(parsed.Options) != len(opt.Options) {
+		t.Fatalf("parsed options %v, want %v", parsed.Options, opt.Options)
+	}
+	for i, option := range parsed.Options {
+		if option.Code != opt.Options[i].Code || !bytes.Equal(option.Data, opt.Options[i].Data) {
+			t.Errorf("option %d = %v, want %v", i, option, opt.Options[i])
+		}
+	}
+}
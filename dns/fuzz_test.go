@@ -0,0 +1,127 @@
+package dns
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+// seedPacket is a response that exercises every record type the parser knows.
+func seedPacket(t testing.TB) []byte {
+	preamble := func(name Name, recordType RecordType) DNSRecordPreamble {
+		return DNSRecordPreamble{Name: name, Type: recordType, Class: ClassType.IN, TTL: 300}
+	}
+	packet := DNSPacket{
+		Header: DNSHeader{ID: 0x1234, QR: 1, RD: 1, RA: 1, QDCOUNT: 1, ANCOUNT: 6, NSCOUNT: 2, ARCOUNT: 3},
+		Questions: []DNSQuestion{
+			{Domain: "www.example.com.", Type: RType.A, Class: ClassType.IN},
+		},
+		Answers: []DNSRecord{
+			CNAMERecord{DNSRecordPreamble: preamble("www.example.com.", RType.CNAME), CanonicalName: "example.com."},
+			ADNSRecord{DNSRecordPreamble: preamble("example.com.", RType.A), IP: net.ParseIP("192.0.2.1")},
+			MXRecord{DNSRecordPreamble: preamble("example.com.", RType.MX), Preference: 10, Exchange: "mail.example.com."},
+			TXTRecord{DNSRecordPreamble: preamble("example.com.", RType.TXT), Text: "\x05hello"},
+			PTRRecord{DNSRecordPreamble: preamble("1.2.0.192.in-addr.arpa.", RType.PTR), Pointer: "example.com."},
+			UnknownRecord{DNSRecordPreamble: preamble("example.com.", RecordType(65280)), Data: []byte{1, 2, 3}},
+		},
+		Authoratives: []DNSRecord{
+			NSDNSRecord{DNSRecordPreamble: preamble("example.com.", RType.NS), Host: "ns1.example.com."},
+			SOARecord{DNSRecordPreamble: preamble("example.com.", RType.SOA), MName: "ns1.example.com.", RName: "hostmaster.example.com.", Serial: 1, Refresh: 2, Retry: 3, Expire: 4, MinimumTTL: 5},
+		},
+		Additional: []DNSRecord{
+			ADNSRecord{DNSRecordPreamble: preamble("ns1.example.com.", RType.A), IP: net.ParseIP("192.0.2.53")},
+			AAAARecord{DNSRecordPreamble: preamble("ns1.example.com.", RType.AAAA), IP: net.ParseIP("2001:db8::53")},
+			OPTRecord{Name: ".", UDPSize: 1232, Options: []EDNSOption{{Code: EDNSOptionCodeType.NSID}}},
+		},
+	}
+	buf, err := packet.ToBytes()
+	if err != nil {
+		t.Fatalf("failed to build seed packet: %v", err)
+	}
+	return buf
+}
+
+func FuzzParseDNSPacket(f *testing.F) {
+	f.Add(seedPacket(f))
+	query := DNSPacket{
+		Header:    DNSHeader{ID: 1, RD: 1, QDCOUNT: 1},
+		Questions: []DNSQuestion{{Domain: "example.com.", Type: RType.AAAA, Class: ClassType.IN}},
+	}
+	queryBytes, err := query.ToBytes()
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(queryBytes)
+	// A compression pointer that points at itself.
+	f.Add([]byte{0, 1, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0xC0, 12, 0, 1, 0, 1})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		packet, err := ParseDNSPacket(data, len(data))
+		if packet == nil {
+			if err == nil {
+				t.Fatal("no packet and no error")
+			}
+			return
+		}
+		_ = packet.String()
+		if err != nil {
+			return
+		}
+		if len(packet.Questions) != int(packet.Header.QDCOUNT) || len(packet.Answers) != int(packet.Header.ANCOUNT) ||
+			len(packet.Authoratives) != int(packet.Header.NSCOUNT) || len(packet.Additional) != int(packet.Header.ARCOUNT) {
+			t.Fatalf("section lengths do not match the header counts: %s", packet.Header)
+		}
+		_, _ = packet.ToBytes()
+	})
+}
+
+// FuzzParseRecord feeds arbitrary RDATA for every known record type through
+// ParseDNSPacket as the only answer of a response.
+func FuzzParseRecord(f *testing.F) {
+	seeds := map[RecordType][][]byte{
+		RType.A:     {{192, 0, 2, 1}},
+		RType.NS:    {{3, 'n', 's', '1', 0}, {0xC0, 12}},
+		RType.CNAME: {{7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 0}},
+		RType.DNAME: {{7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 0}},
+		RType.PTR:   {{7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 0}},
+		RType.TXT:   {{5, 'h', 'e', 'l', 'l', 'o'}},
+		RType.MX:    {{0, 10, 4, 'm', 'a', 'i', 'l', 0}},
+		RType.AAAA:  {net.ParseIP("2001:db8::1")},
+		RType.SOA:   {append([]byte{2, 'n', 's', 0, 4, 'h', 'o', 's', 't', 0}, make([]byte, 20)...)},
+		RType.OPT:   {{}, {0, 3, 0, 0}, {0, 8, 0, 7, 0, 1, 24, 0, 192, 0, 2}},
+	}
+	for recordType := range RecordName {
+		rdatas, ok := seeds[recordType]
+		if !ok {
+			rdatas = [][]byte{{}}
+		}
+		for _, rdata := range rdatas {
+			f.Add(uint16(recordType), rdata)
+		}
+	}
+
+	f.Fuzz(func(t *testing.T, recordType uint16, rdata []byte) {
+		if len(rdata) > 0xFFFF {
+			return
+		}
+		msg := []byte{0, 1, 0x80, 0, 0, 0, 0, 1, 0, 0, 0, 0}
+		msg = append(msg, 0) // Root owner name, required for OPT
+		fixed := make([]byte, 10)
+		binary.BigEndian.PutUint16(fixed[0:2], recordType)
+		binary.BigEndian.PutUint16(fixed[2:4], uint16(ClassType.IN))
+		binary.BigEndian.PutUint32(fixed[4:8], 300)
+		binary.BigEndian.PutUint16(fixed[8:10], uint16(len(rdata)))
+		msg = append(append(msg, fixed...), rdata...)
+
+		packet, err := ParseDNSPacket(msg, len(msg))
+		if err != nil {
+			return
+		}
+		record := packet.Answers[0]
+		if record.Preamble().Type != RecordType(recordType) {
+			t.Fatalf("parsed a %s record from a %s record", record.Preamble().Type, RecordType(recordType))
+		}
+		_ = record.String()
+		_, _ = record.ToBytes(make(map[string]uint), 12)
+	})
+}
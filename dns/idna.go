@@ -0,0 +1,133 @@
+package dns
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// idnaProfile applies UTS #46 processing for lookups. Unlike idna.Lookup it
+// accepts ASCII that is fine in DNS but not in host names, like the
+// underscore in _dmarc.example.com.
+var idnaProfile = idna.New(
+	idna.MapForLookup(),
+	idna.StrictDomainName(false),
+	idna.BidiRule(),
+	idna.Transitional(false),
+)
+
+// aLabelPrefix marks a label as the Punycode form of a Unicode label.
+const aLabelPrefix = "xn--"
+
+// labelSeparators are the dots UTS #46 treats as label separators.
+var labelSeparators = strings.NewReplacer("。", ".", "．", ".", "｡", ".")
+
+func isALabel(label string) bool {
+	return len(label) >= len(aLabelPrefix) && strings.EqualFold(label[:len(aLabelPrefix)], aLabelPrefix)
+}
+
+func isASCII(label string) bool {
+	for i := 0; i < len(label); i++ {
+		if label[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// ToASCII converts a name that may contain Unicode labels, such as
+// "bücher.example", to its A-label form "xn--bcher-kva.example.". ASCII
+// labels are kept as they are, case included, and A-labels must be
+// well-formed Punycode.
+func ToASCII(name string) (Name, error) {
+	labels, err := splitName(labelSeparators.Replace(name))
+	if err != nil {
+		return "", err
+	}
+	for i, label := range labels {
+		if isASCII(label) {
+			if isALabel(label) {
+				if err := checkPunycode(label); err != nil {
+					return "", err
+				}
+			}
+			continue
+		}
+		aLabel, err := idnaProfile.ToASCII(label)
+		if err != nil {
+			return "", fmt.Errorf("invalid internationalized label %q: %v", label, err)
+		}
+		labels[i] = aLabel
+	}
+	return nameFromRawLabels(labels), nil
+}
+
+// ToUnicode returns n in presentation format with every A-label that is
+// valid under UTS #46 replaced by its Unicode label. Other labels are kept
+// as they are.
+func (n Name) ToUnicode() string {
+	labels := n.rawLabels()
+	if len(labels) == 0 {
+		return string(RootName)
+	}
+	for i, label := range labels {
+		if isALabel(label) && validateALabel(label) == nil {
+			if uLabel, err := idnaProfile.ToUnicode(label); err == nil {
+				labels[i] = uLabel
+				continue
+			}
+		}
+		labels[i] = escapeLabel([]byte(label))
+	}
+	return strings.Join(labels, ".") + "."
+}
+
+// ValidateALabels returns an error if a label of n claims to be an A-label
+// but is not well-formed Punycode. Labels that decode fine but break the
+// IDNA2008 rules, like emoji or names registered under IDNA2003, are
+// accepted: they exist in the DNS and it is not up to a resolver to judge.
+func (n Name) ValidateALabels() error {
+	for _, label := range n.rawLabels() {
+		if isALabel(label) {
+			if err := checkPunycode(label); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkPunycode checks that an A-label decodes to a non-ASCII label that
+// encodes back to the same A-label.
+func checkPunycode(label string) error {
+	label = asciiLower(label)
+	uLabel, err := idna.Punycode.ToUnicode(label)
+	if err != nil {
+		return fmt.Errorf("invalid A-label %q: %v", label, err)
+	}
+	if isASCII(uLabel) {
+		return fmt.Errorf("invalid A-label %q: does not encode a Unicode label", label)
+	}
+	if aLabel, err := idna.Punycode.ToASCII(uLabel); err != nil || aLabel != label {
+		return fmt.Errorf("invalid A-label %q: not the canonical encoding of %q", label, uLabel)
+	}
+	return nil
+}
+
+// validateALabel checks that an A-label encodes a Unicode label that is
+// valid for lookups under UTS #46, which is required to display it.
+func validateALabel(label string) error {
+	uLabel, err := idnaProfile.ToUnicode(label)
+	if err != nil {
+		return fmt.Errorf("invalid A-label %q: %v", label, err)
+	}
+	aLabel, err := idnaProfile.ToASCII(uLabel)
+	if err != nil {
+		return fmt.Errorf("invalid A-label %q: %v", label, err)
+	}
+	if aLabel != asciiLower(label) {
+		return fmt.Errorf("invalid A-label %q: not the canonical encoding of %q", label, uLabel)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package dns
+
+import "testing"
+
+func TestToASCII(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    Name
+		wantErr bool
+	}{
+		{"bücher.example", "xn--bcher-kva.example.", false},
+		{"BÜCHER.example.", "xn--bcher-kva.example.", false},
+		{"münchen。de", "xn--mnchen-3ya.de.", false},
+		{"WWW.Example.COM", "WWW.Example.COM.", false},
+		{"_dmarc.example.com.", "_dmarc.example.com.", false},
+		{"xn--bcher-kva.example.", "xn--bcher-kva.example.", false},
+		{"xn--ls8h.la.", "xn--ls8h.la.", false},
+		{"xn--zzzzzzzzz.example.", "", true},
+		{"xn--bcher-kva-.example.", "", true},
+		{"a..example.", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ToASCII(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ToASCII(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ToASCII(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToUnicode(t *testing.T) {
+	tests := []struct {
+		name Name
+		want string
+	}{
+		{"xn--bcher-kva.example.", "bücher.example."},
+		{"XN--BCHER-KVA.example.", "bücher.example."},
+		{"www.xn--mnchen-3ya.de", "www.münchen.de."},
+		{".", "."},
+		{`a\.b.example.`, `a\.b.example.`},
+		{"xn--ls8h.la.", "💩.la."},
+		// Not an A-label, so kept in ASCII.
+		{"xn--zzzzzzzzz.example.", "xn--zzzzzzzzz.example."},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.name), func(t *testing.T) {
+			if got := tt.name.ToUnicode(); got != tt.want {
+				t.Errorf("ToUnicode(%s) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateALabels(t *testing.T) {
+	tests := []struct {
+		name    Name
+		wantErr bool
+	}{
+		{"www.example.com.", false},
+		{"xn--bcher-kva.example.", false},
+		{"XN--BCHER-KVA.example.", false},
+		// Emoji and IDNA2003 labels break UTS #46 but exist in the DNS.
+		{"xn--ls8h.la.", false},
+		{"xn--a-ecp.ru.", false},
+		{"xn--zzzzzzzzz.example.", true},
+		{"xn--.example.", true},
+		{"xn--bcher-kva-.example.", true},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.name), func(t *testing.T) {
+			if err := tt.name.ValidateALabels(); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateALabels(%s) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package dns
+
+import (
+	"bytes"
+	"math/rand"
+	"slices"
+	"strings"
+)
+
+// Name is a domain name in presentation format, for example "www.example.com.".
+// Labels may contain \. and \DDD escapes. Names compare without regard to
+// ASCII case (RFC 4343), so use Equal rather than == to compare them.
+type Name string
+
+// RootName is the name of the root zone.
+const RootName Name = "."
+
+// rawLabels returns the unescaped labels of n, leftmost first and without the
+// root label. A name with broken escapes is split on every dot instead.
+func (n Name) rawLabels() []string {
+	labels, err := splitName(string(n))
+	if err != nil {
+		trimmed := strings.TrimSuffix(string(n), ".")
+		if trimmed == "" {
+			return nil
+		}
+		return strings.Split(trimmed, ".")
+	}
+	return labels
+}
+
+// nameFromRawLabels joins unescaped labels into a fully qualified name.
+func nameFromRawLabels(labels []string) Name {
+	if len(labels) == 0 {
+		return RootName
+	}
+	escaped := make([]string, len(labels))
+	for i, label := range labels {
+		escaped[i] = escapeLabel([]byte(label))
+	}
+	return Name(strings.Join(escaped, ".") + ".")
+}
+
+// asciiLower lower-cases the ASCII letters of a label and leaves every other
+// byte alone.
+func asciiLower(label string) string {
+	lower := []byte(label)
+	for i, c := range lower {
+		if c >= 'A' && c <= 'Z' {
+			lower[i] = c + 'a' - 'A'
+		}
+	}
+	return string(lower)
+}
+
+func (n Name) String() string {
+	return string(n)
+}
+
+// FQDN returns n with the trailing root label, "." for an empty name.
+func (n Name) FQDN() Name {
+	return nameFromRawLabels(n.rawLabels())
+}
+
+// Canonical returns the lower-cased FQDN of n, suitable as a map key.
+func (n Name) Canonical() Name {
+	labels := n.rawLabels()
+	for i, label := range labels {
+		labels[i] = asciiLower(label)
+	}
+	return nameFromRawLabels(labels)
+}
+
+// IsRoot reports whether n is the root name.
+func (n Name) IsRoot() bool {
+	return len(n.rawLabels()) == 0
+}
+
+// Labels returns the labels of n in presentation format, leftmost first and
+// without the root label.
+func (n Name) Labels() []string {
+	labels := n.rawLabels()
+	for i, label := range labels {
+		labels[i] = escapeLabel([]byte(label))
+	}
+	return labels
+}
+
+// CountLabels returns the number of labels in n, not counting the root.
+func (n Name) CountLabels() int {
+	return len(n.rawLabels())
+}
+
+// Suffix returns the name made of the rightmost count labels of n.
+func (n Name) Suffix(count int) Name {
+	labels := n.rawLabels()
+	if count >= len(labels) {
+		return nameFromRawLabels(labels)
+	}
+	return nameFromRawLabels(labels[len(labels)-max(count, 0):])
+}
+
+// Parent returns n without its leftmost label. The parent of the root is the
+// root itself.
+func (n Name) Parent() Name {
+	labels := n.rawLabels()
+	if len(labels) == 0 {
+		return RootName
+	}
+	return nameFromRawLabels(labels[1:])
+}
+
+// Equal reports whether n and other are the same name, ignoring ASCII case.
+func (n Name) Equal(other Name) bool {
+	a, b := n.rawLabels(), other.rawLabels()
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if asciiLower(a[i]) != asciiLower(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// EqualCase reports whether n and other are the same name spelled with the
+// same letter case.
+func (n Name) EqualCase(other Name) bool {
+	return slices.Equal(n.rawLabels(), other.rawLabels())
+}
+
+// RandomCase returns n with the case of every ASCII letter picked at random,
+// the "0x20" bits that upstream servers are expected to echo back.
+func (n Name) RandomCase() Name {
+	labels := n.rawLabels()
+	for i, label := range labels {
+		randomised := []byte(label)
+		for j, c := range randomised {
+			if lower := c | 0x20; lower >= 'a' && lower <= 'z' {
+				randomised[j] = lower &^ byte(rand.Intn(2)<<5)
+			}
+		}
+		labels[i] = string(randomised)
+	}
+	return nameFromRawLabels(labels)
+}
+
+// Compare orders names canonically (RFC 4034 section 6.1): label by label
+// from the root down, comparing lower-cased labels as unsigned bytes, with a
+// name sorting before its subdomains. It returns -1, 0 or +1.
+func (n Name) Compare(other Name) int {
+	a, b := n.rawLabels(), other.rawLabels()
+	for i := 1; i <= len(a) && i <= len(b); i++ {
+		if c := bytes.Compare([]byte(asciiLower(a[len(a)-i])), []byte(asciiLower(b[len(b)-i]))); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(a) < len(b):
+		return -1
+	case len(a) > len(b):
+		return 1
+	default:
+		return 0
+	}
+}
+
+// IsSubdomainOf reports whether n is equal to or below zone.
+func (n Name) IsSubdomainOf(zone Name) bool {
+	zoneLabels := zone.rawLabels()
+	return n.commonLabels(zoneLabels) == len(zoneLabels)
+}
+
+// CommonSuffix returns the closest ancestor shared by n and other, which is
+// the root for unrelated names.
+func (n Name) CommonSuffix(other Name) Name {
+	labels := n.rawLabels()
+	return nameFromRawLabels(labels[len(labels)-other.commonLabels(labels):])
+}
+
+// commonLabels counts the rightmost labels that n has in common with labels.
+func (n Name) commonLabels(labels []string) int {
+	own := n.rawLabels()
+	count := 0
+	for count < len(own) && count < len(labels) {
+		if asciiLower(own[len(own)-1-count]) != asciiLower(labels[len(labels)-1-count]) {
+			break
+		}
+		count++
+	}
+	return count
+}
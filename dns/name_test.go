@@ -0,0 +1,231 @@
+package dns
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCompareCanonicalOrder(t *testing.T) {
+	// The example of RFC 4034 section 6.1, in canonical order.
+	ordered := []Name{
+		"example.",
+		"a.example.",
+		"yljkjljk.a.example.",
+		"Z.a.example.",
+		"zABC.a.EXAMPLE.",
+		"z.example.",
+		`\001.z.example.`,
+		"*.z.example.",
+		`\200.z.example.`,
+	}
+	for i := range ordered {
+		for j := range ordered {
+			want := 0
+			if i < j {
+				want = -1
+			} else if i > j {
+				want = 1
+			}
+			if got := ordered[i].Compare(ordered[j]); got != want {
+				t.Errorf("Compare(%s, %s) = %d, want %d", ordered[i], ordered[j], got, want)
+			}
+		}
+	}
+
+	shuffled := slices.Clone(ordered)
+	slices.Reverse(shuffled)
+	slices.SortFunc(shuffled, Name.Compare)
+	if !slices.Equal(shuffled, ordered) {
+		t.Errorf("sorted names = %v, want %v", shuffled, ordered)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		a, b Name
+		want int
+	}{
+		{".", ".", 0},
+		{"", ".", 0},
+		{".", "com.", -1},
+		{"com.", ".", 1},
+		{"EXAMPLE.com", "example.COM.", 0},
+		{`a\.b.example.`, "a.b.example.", -1},
+		{`b\.a.example.`, "a.b.example.", 1},
+		{`a\.b.example.`, `a\046b.example.`, 0},
+		{"a.example.", "b.example.", -1},
+	}
+	for _, tt := range tests {
+		if got := tt.a.Compare(tt.b); got != tt.want {
+			t.Errorf("Compare(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestEqual(t *testing.T) {
+	tests := []struct {
+		a, b           Name
+		equal, exactly bool
+	}{
+		{".", ".", true, true},
+		{"", ".", true, true},
+		{".", "com.", false, false},
+		{"example.com", "example.com.", true, true},
+		{"Example.COM.", "example.com.", true, false},
+		{`a\.b.example.`, "a.b.example.", false, false},
+		{`a\.b.example.`, `A\046B.example.`, true, false},
+		{`a\.b.example.`, `a\046b.example.`, true, true},
+		{"www.example.com.", "example.com.", false, false},
+		// Only ASCII letters are folded.
+		{`\195\156.example.`, `\195\188.example.`, false, false},
+	}
+	for _, tt := range tests {
+		if got := tt.a.Equal(tt.b); got != tt.equal {
+			t.Errorf("Equal(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.equal)
+		}
+		if got := tt.b.Equal(tt.a); got != tt.equal {
+			t.Errorf("Equal(%q, %q) = %v, want %v", tt.b, tt.a, got, tt.equal)
+		}
+		if got := tt.a.EqualCase(tt.b); got != tt.exactly {
+			t.Errorf("EqualCase(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.exactly)
+		}
+	}
+}
+
+func TestIsSubdomainOf(t *testing.T) {
+	tests := []struct {
+		name, zone Name
+		want       bool
+	}{
+		{".", ".", true},
+		{"com.", ".", true},
+		{"www.example.com.", ".", true},
+		{".", "com.", false},
+		{"example.com.", "example.com.", true},
+		{"WWW.example.com.", "EXAMPLE.com", true},
+		{"example.com.", "www.example.com.", false},
+		{"badexample.com.", "example.com.", false},
+		{`a.b\.example.com.`, `b\.example.com.`, true},
+		{`a.b\.example.com.`, "example.com.", false},
+		{"b.example.com.", `b\.example.com.`, false},
+	}
+	for _, tt := range tests {
+		if got := tt.name.IsSubdomainOf(tt.zone); got != tt.want {
+			t.Errorf("IsSubdomainOf(%q, %q) = %v, want %v", tt.name, tt.zone, got, tt.want)
+		}
+	}
+}
+
+func TestCommonSuffix(t *testing.T) {
+	tests := []struct {
+		a, b, want Name
+	}{
+		{".", ".", "."},
+		{"www.example.com.", ".", "."},
+		{".", "www.example.com.", "."},
+		{"www.example.com.", "mail.EXAMPLE.com.", "example.com."},
+		{"example.com.", "example.net.", "."},
+		{"a.example.com.", "example.com.", "example.com."},
+		{`x.a\.b.example.`, "y.b.example.", "example."},
+		{`x.a\.b.example.`, `y.a\.b.example.`, `a\.b.example.`},
+	}
+	for _, tt := range tests {
+		if got := tt.a.CommonSuffix(tt.b); got != tt.want {
+			t.Errorf("CommonSuffix(%q, %q) = %q, want %q", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestParent(t *testing.T) {
+	tests := []struct {
+		name, want Name
+	}{
+		{".", "."},
+		{"", "."},
+		{"com.", "."},
+		{"www.example.com", "example.com."},
+		{`a\.b.example.`, "example."},
+		{`x.a\.b.example.`, `a\.b.example.`},
+	}
+	for _, tt := range tests {
+		if got := tt.name.Parent(); got != tt.want {
+			t.Errorf("Parent(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSuffix(t *testing.T) {
+	tests := []struct {
+		name  Name
+		count int
+		want  Name
+	}{
+		{".", 0, "."},
+		{".", 3, "."},
+		{"www.example.com.", 0, "."},
+		{"www.example.com.", 1, "com."},
+		{"www.example.com.", 2, "example.com."},
+		{"www.example.com.", 3, "www.example.com."},
+		{"www.example.com", 5, "www.example.com."},
+		{"www.example.com.", -1, "."},
+		{`x.a\.b.example.`, 2, `a\.b.example.`},
+	}
+	for _, tt := range tests {
+		if got := tt.name.Suffix(tt.count); got != tt.want {
+			t.Errorf("Suffix(%q, %d) = %q, want %q", tt.name, tt.count, got, tt.want)
+		}
+	}
+}
+
+func TestLabels(t *testing.T) {
+	tests := []struct {
+		name Name
+		want []string
+	}{
+		{".", nil},
+		{"", nil},
+		{"www.example.com.", []string{"www", "example", "com"}},
+		{`a\.b.example`, []string{`a\.b`, "example"}},
+		{`a\046b.example.`, []string{`a\.b`, "example"}},
+		{`\065\032b.example.`, []string{`A\032b`, "example"}},
+	}
+	for _, tt := range tests {
+		got := tt.name.Labels()
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("Labels(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+		if got, want := tt.name.CountLabels(), len(tt.want); got != want {
+			t.Errorf("CountLabels(%q) = %d, want %d", tt.name, got, want)
+		}
+	}
+}
+
+func TestCanonical(t *testing.T) {
+	tests := []struct {
+		name, want Name
+	}{
+		{".", "."},
+		{"", "."},
+		{"WWW.Example.COM", "www.example.com."},
+		{`A\.B.example.`, `a\.b.example.`},
+		{`\065.example.`, "a.example."},
+	}
+	for _, tt := range tests {
+		if got := tt.name.Canonical(); got != tt.want {
+			t.Errorf("Canonical(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+		if !tt.name.IsRoot() && tt.name.Canonical().IsRoot() {
+			t.Errorf("Canonical(%q) is the root", tt.name)
+		}
+	}
+}
+
+func TestRandomCase(t *testing.T) {
+	names := []Name{".", "www.example.com.", `a\.b.Example.`, `\001-x.example.`}
+	for _, name := range names {
+		randomised := name.RandomCase()
+		if !randomised.Equal(name) {
+			t.Errorf("RandomCase(%q) = %q is a different name", name, randomised)
+		}
+	}
+}
@@ -7,75 +7,117 @@ import (
 	"net"
 )
 
+// ErrTruncated is returned together with the partially parsed packet when the
+// sender set the TC bit. Only records that were received in full are kept and
+// the header counts are adjusted to match them.
+var ErrTruncated = errors.New("truncated DNS packet")
+
+// ParseDNSPacket decodes a DNS message. Malformed messages are reported with
+// a *ParseError; if the header could be read, the partially parsed packet is
+// returned alongside it so that callers can still answer with FORMERR.
 func ParseDNSPacket(data []byte, size int) (*DNSPacket, error) {
 
-	if size < 12 {
-		return nil, fmt.Errorf("The size of the request is %d (invalid request)", size)
+	if size < 12 || size > len(data) {
+		return nil, newParseError(size, ParseErrorReasonType.ShortMessage, fmt.Sprintf("the size of the message is %d", size))
 	}
 
 	buf := data[:size]
 	headerBytes := buf[:12]
 	header := parseHeader(headerBytes)
 
-	if header.TC == 1 {
-		return nil, errors.New("Truncated DNS packet")
+	packet := &DNSPacket{Header: *header}
+	err := parseSections(buf, packet)
+
+	if packet.Header.TC == 1 {
+		packet.Header.QDCOUNT = uint16(len(packet.Questions))
+		packet.Header.ANCOUNT = uint16(len(packet.Answers))
+		packet.Header.NSCOUNT = uint16(len(packet.Authoratives))
+		packet.Header.ARCOUNT = uint16(len(packet.Additional))
+		mergeExtendedRCODE(packet)
+		return packet, ErrTruncated
+	}
+	if err != nil {
+		return packet, err
 	}
 
+	mergeExtendedRCODE(packet)
+	return packet, nil
+}
+
+// Smallest possible wire size of a question and of a resource record, used to
+// keep hostile header counts from causing large allocations.
+const (
+	minQuestionSize = 5  // Root name, type and class
+	minRecordSize   = 11 // Root name, type, class, TTL and RDLENGTH
+)
+
+// parseSections fills the sections of packet from buf. On error the sections
+// hold everything that was parsed before the failure.
+func parseSections(buf []byte, packet *DNSPacket) error {
+	header := packet.Header
 	curr := 12 // Start after the header
 
-	questions := make([]DNSQuestion, 0, header.QDCOUNT)
-	for range header.QDCOUNT {
+	packet.Questions = make([]DNSQuestion, 0, min(int(header.QDCOUNT), (len(buf)-curr)/minQuestionSize))
+	for i := range int(header.QDCOUNT) {
 		if curr >= len(buf) {
-			return nil, fmt.Errorf("Invalid QDCOUNT: %d, but buffer length is %d", header.QDCOUNT, len(buf))
+			err := newParseError(curr, ParseErrorReasonType.CountMismatch, fmt.Sprintf("QDCOUNT is %d", header.QDCOUNT))
+			return locate(err, SectionType.Question, i)
 		}
 		question, end, err := parseQuestion(buf, curr)
 		if err != nil {
-			return nil, err
+			return locate(err, SectionType.Question, i)
 		}
-		questions = append(questions, *question)
+		packet.Questions = append(packet.Questions, *question)
 		curr = end
 	}
 
-	answers := make([]DNSRecord, 0, header.ANCOUNT)
-	for range header.ANCOUNT {
-		if curr >= len(buf) {
-			return nil, fmt.Errorf("Invalid ANCOUNT: %d, but buffer length is %d", header.ANCOUNT, len(buf))
-		}
-		answerRecord, end, err := parseRecord(buf, curr)
-		if err != nil {
-			return nil, err
-		}
-		answers = append(answers, answerRecord)
-		curr = end
+	var err error
+	if packet.Answers, curr, err = parseRecords(buf, curr, header.ANCOUNT, SectionType.Answer); err != nil {
+		return err
+	}
+	if packet.Authoratives, curr, err = parseRecords(buf, curr, header.NSCOUNT, SectionType.Authority); err != nil {
+		return err
+	}
+	if packet.Additional, curr, err = parseRecords(buf, curr, header.ARCOUNT, SectionType.Additional); err != nil {
+		return err
 	}
 
-	authoratives := make([]DNSRecord, 0, header.NSCOUNT)
-	for range header.NSCOUNT {
-		if curr >= len(buf) {
-			return nil, fmt.Errorf("Invalid NSCOUNT: %d, but buffer length is %d", header.NSCOUNT, len(buf))
-		}
-		authoritativeRecord, end, err := parseRecord(buf, curr)
-		if err != nil {
-			return nil, err
-		}
-		authoratives = append(authoratives, authoritativeRecord)
-		curr = end
+	if curr != len(buf) {
+		err := newParseError(curr, ParseErrorReasonType.TrailingData, fmt.Sprintf("%d bytes", len(buf)-curr))
+		return locate(err, SectionType.Additional, len(packet.Additional))
 	}
+	return nil
+}
 
-	additionals := make([]DNSRecord, 0, header.ARCOUNT)
-	for range header.ARCOUNT {
+// parseRecords parses count resource records of section starting at curr and
+// returns them with the offset just past the last one. On error it returns the
+// records parsed so far.
+func parseRecords(buf []byte, curr int, count uint16, section Section) ([]DNSRecord, int, error) {
+	records := make([]DNSRecord, 0, min(int(count), (len(buf)-curr)/minRecordSize))
+	for i := range int(count) {
 		if curr >= len(buf) {
-			return nil, fmt.Errorf("Invalid ARCOUNT: %d, but buffer length is %d", header.ARCOUNT, len(buf))
+			err := newParseError(curr, ParseErrorReasonType.CountMismatch, fmt.Sprintf("%s count is %d", section, count))
+			return records, curr, locate(err, section, i)
 		}
-		additionalRecord, end, err := parseRecord(buf, curr)
+		record, end, err := parseRecord(buf, curr)
 		if err != nil {
-			return nil, err
+			return records, curr, locate(err, section, i)
 		}
-		additionals = append(additionals, additionalRecord)
+		records = append(records, record)
 		curr = end
 	}
+	return records, curr, nil
+}
 
-	return &DNSPacket{Header: *header, Questions: questions, Answers: answers, Authoratives: authoratives, Additional: additionals}, nil
+// mergeExtendedRCODE adds the upper 8 bits of the response code carried in
+// the OPT record to the header.
+func mergeExtendedRCODE(packet *DNSPacket) {
+	for _, additional := range packet.Additional {
+		if opt, ok := additional.(OPTRecord); ok {
+			packet.Header.RCODE |= DNSResponseCode(opt.ExtRCODE) << 4
+			return
+		}
+	}
 }
 
 func parseHeader(headerBytes []byte) *DNSHeader {
@@ -118,7 +160,7 @@ func parseQuestion(question []byte, start int) (*DNSQuestion, int, error) {
 	}
 
 	if end+4 >= len(question) {
-		return nil, -1, errors.New("Invalid question")
+		return nil, -1, newParseError(end+1, ParseErrorReasonType.ShortMessage, "question type and class")
 	}
 	recordType := question[end+1 : end+3]
 	class := question[end+3 : end+5]
@@ -129,6 +171,19 @@ func parseQuestion(question []byte, start int) (*DNSQuestion, int, error) {
 	}, end + 5, nil
 }
 
+// decodeRDATAName decodes a name that must end exactly at rdEnd, the offset
+// just past the RDATA it belongs to, and returns the offset after it.
+func decodeRDATAName(record []byte, start int, rdEnd int) (Name, int, error) {
+	if start >= rdEnd {
+		return "", -1, newParseError(start, ParseErrorReasonType.InvalidRDATA, "missing name")
+	}
+	name, end, err := decodeDomainName(record[:rdEnd], start)
+	if err != nil {
+		return "", -1, err
+	}
+	return name, end + 1, nil
+}
+
 func parseRecord(record []byte, start int) (DNSRecord, int, error) {
 	domainName, end, err := decodeDomainName(record, start)
 	if err != nil {
@@ -136,7 +191,7 @@ func parseRecord(record []byte, start int) (DNSRecord, int, error) {
 	}
 
 	if end+11 > len(record) {
-		return nil, -1, errors.New("Invalid record")
+		return nil, -1, newParseError(end+1, ParseErrorReasonType.ShortMessage, "record type, class, TTL and RDLENGTH")
 	}
 
 	recordType := binary.BigEndian.Uint16(record[end+1 : end+3])
@@ -144,11 +199,13 @@ func parseRecord(record []byte, start int) (DNSRecord, int, error) {
 	ttl := binary.BigEndian.Uint32(record[end+5 : end+9])
 	rdLength := binary.BigEndian.Uint16(record[end+9 : end+11])
 
-	if end+11+int(rdLength) > len(record) {
-		return nil, -1, errors.New("Invalid RDATA length")
+	rdStart := end + 11
+	rdEnd := rdStart + int(rdLength)
+	if rdEnd > len(record) {
+		return nil, -1, newParseError(end+9, ParseErrorReasonType.InvalidRDLength, fmt.Sprintf("RDLENGTH is %d", rdLength))
 	}
 
-	rdata := record[end+11 : end+11+int(rdLength)]
+	rdata := record[rdStart:rdEnd]
 
 	recordPreamble := DNSRecordPreamble{
 		Name:  domainName,
@@ -157,58 +214,121 @@ func parseRecord(record []byte, start int) (DNSRecord, int, error) {
 		TTL:   ttl,
 	}
 
+	var parsed DNSRecord
+	nameEnd := rdEnd
+
 	switch recordType {
 	case uint16(RType.A): // A record
-		return ADNSRecord{DNSRecordPreamble: recordPreamble, IP: net.IP(rdata)}, end + 11 + int(rdLength), nil
+		if len(rdata) != net.IPv4len {
+			return nil, -1, newParseError(rdStart, ParseErrorReasonType.InvalidRDATA, "A record must be 4 bytes")
+		}
+		parsed = ADNSRecord{DNSRecordPreamble: recordPreamble, IP: net.IP(append([]byte(nil), rdata...))}
 	case uint16(RType.NS): // NS record
-		host, _, _ := decodeDomainName(record, end+11)
-		return NSDNSRecord{DNSRecordPreamble: recordPreamble, Host: host}, end + 11 + int(rdLength), nil
+		var host Name
+		host, nameEnd, err = decodeRDATAName(record, rdStart, rdEnd)
+		parsed = NSDNSRecord{DNSRecordPreamble: recordPreamble, Host: host}
 	case uint16(RType.CNAME): // CNAME record
-		return CNAMERecord{DNSRecordPreamble: recordPreamble, CanonicalName: string(rdata)}, end + 11 + int(rdLength), nil
+		var canonicalName Name
+		canonicalName, nameEnd, err = decodeRDATAName(record, rdStart, rdEnd)
+		parsed = CNAMERecord{DNSRecordPreamble: recordPreamble, CanonicalName: canonicalName}
+	case uint16(RType.DNAME): // DNAME record
+		var target Name
+		target, nameEnd, err = decodeRDATAName(record, rdStart, rdEnd)
+		parsed = DNAMERecord{DNSRecordPreamble: recordPreamble, Target: target}
+	case uint16(RType.PTR): // PTR record
+		var pointer Name
+		pointer, nameEnd, err = decodeRDATAName(record, rdStart, rdEnd)
+		parsed = PTRRecord{DNSRecordPreamble: recordPreamble, Pointer: pointer}
 	case uint16(RType.TXT): // TXT record
-		return TXTRecord{DNSRecordPreamble: recordPreamble, Text: string(rdata)}, end + 11 + int(rdLength), nil
+		parsed = TXTRecord{DNSRecordPreamble: recordPreamble, Text: string(rdata)}
 	case uint16(RType.MX): // MX record
+		if len(rdata) < 3 {
+			return nil, -1, newParseError(rdStart, ParseErrorReasonType.InvalidRDATA, "MX record too short")
+		}
 		preference := binary.BigEndian.Uint16(rdata[:2])
-		exchange, _, _ := decodeDomainName(record, end+13)
-		return MXRecord{DNSRecordPreamble: recordPreamble, Preference: preference, Exchange: exchange}, end + 11 + int(rdLength), nil
+		var exchange Name
+		exchange, nameEnd, err = decodeRDATAName(record, rdStart+2, rdEnd)
+		parsed = MXRecord{DNSRecordPreamble: recordPreamble, Preference: preference, Exchange: exchange}
 	case uint16(RType.AAAA): // AAAA record
-		return AAAARecord{DNSRecordPreamble: recordPreamble, IP: net.IP(rdata)}, end + 11 + int(rdLength), nil
+		if len(rdata) != net.IPv6len {
+			return nil, -1, newParseError(rdStart, ParseErrorReasonType.InvalidRDATA, "AAAA record must be 16 bytes")
+		}
+		parsed = AAAARecord{DNSRecordPreamble: recordPreamble, IP: net.IP(append([]byte(nil), rdata...))}
 	case uint16(RType.SOA): // SOA record
-		return SOARecord{DNSRecordPreamble: recordPreamble}, end + 11 + int(rdLength), nil
+		parsed, nameEnd, err = parseSOA(record, recordPreamble, rdStart, rdEnd)
 	case uint16(RType.OPT): // OPT record
-		if domainName != "." {
-			return nil, -1, errors.New("Invalid OPT record domain name")
-		}
+		parsed, err = parseOPT(record, start, domainName, class, ttl, rdStart, rdEnd)
+	default:
+		// Keep records we do not understand as opaque data (RFC 3597).
+		parsed = UnknownRecord{DNSRecordPreamble: recordPreamble, Data: append([]byte(nil), rdata...)}
+	}
 
-		// Time to get those options
-
-		options := make([]EDNSOption, 0)
-
-		i := 0
-		for i+4 <= len(rdata) {
-			optionCode := binary.BigEndian.Uint16(rdata[i : i+2])
-			optionLength := binary.BigEndian.Uint16(rdata[i+2 : i+4])
-			if i+4+int(optionLength) > len(rdata) {
-				return nil, -1, errors.New("Invalid OPT record option length")
-			}
-			optionData := rdata[i+4 : i+4+int(optionLength)]
-			i += 4 + int(optionLength)
-			options = append(options, EDNSOption{
-				Code: optionCode,
-				Data: optionData,
-			})
-		}
+	if err != nil {
+		return nil, -1, err
+	}
+	if nameEnd != rdEnd {
+		return nil, -1, newParseError(nameEnd, ParseErrorReasonType.InvalidRDATA, "RDATA longer than its contents")
+	}
+	return parsed, rdEnd, nil
+}
 
-		return OPTRecord{
-			Name:     domainName,
-			UDPSize:  class,
-			ExtRCODE: uint8((ttl & 0xFF000000) >> 24),
-			Version:  uint8((ttl & 0x00FF0000) >> 16),
-			DO:       (ttl & 0x00008000) != 0,
-			Z:        uint16((ttl & 0x00007FFF) >> 15),
-			Options:  options,
-		}, end + 11 + int(rdLength), nil
-	default:
-		return nil, -1, errors.New("Unknown record type")
+func parseSOA(record []byte, recordPreamble DNSRecordPreamble, rdStart int, rdEnd int) (DNSRecord, int, error) {
+	mName, curr, err := decodeRDATAName(record, rdStart, rdEnd)
+	if err != nil {
+		return nil, -1, err
+	}
+	rName, curr, err := decodeRDATAName(record, curr, rdEnd)
+	if err != nil {
+		return nil, -1, err
+	}
+	if curr+20 > rdEnd {
+		return nil, -1, newParseError(curr, ParseErrorReasonType.InvalidRDATA, "SOA record too short")
+	}
+	return SOARecord{
+		DNSRecordPreamble: recordPreamble,
+		MName:             mName,
+		RName:             rName,
+		Serial:            binary.BigEndian.Uint32(record[curr : curr+4]),
+		Refresh:           binary.BigEndian.Uint32(record[curr+4 : curr+8]),
+		Retry:             binary.BigEndian.Uint32(record[curr+8 : curr+12]),
+		Expire:            binary.BigEndian.Uint32(record[curr+12 : curr+16]),
+		MinimumTTL:        binary.BigEndian.Uint32(record[curr+16 : curr+20]),
+	}, curr + 20, nil
+}
+
+func parseOPT(record []byte, start int, domainName Name, class uint16, ttl uint32, rdStart int, rdEnd int) (DNSRecord, error) {
+	if !domainName.IsRoot() {
+		return nil, newParseError(start, ParseErrorReasonType.InvalidOPT, "owner name must be the root")
 	}
+
+	rdata := record[rdStart:rdEnd]
+	options := make([]EDNSOption, 0)
+
+	i := 0
+	for i < len(rdata) {
+		if i+4 > len(rdata) {
+			return nil, newParseError(rdStart+i, ParseErrorReasonType.InvalidOPT, "option header runs past RDATA")
+		}
+		optionCode := binary.BigEndian.Uint16(rdata[i : i+2])
+		optionLength := binary.BigEndian.Uint16(rdata[i+2 : i+4])
+		if i+4+int(optionLength) > len(rdata) {
+			return nil, newParseError(rdStart+i+2, ParseErrorReasonType.InvalidOPT, "option length runs past RDATA")
+		}
+		optionData := rdata[i+4 : i+4+int(optionLength)]
+		i += 4 + int(optionLength)
+		options = append(options, EDNSOption{
+			Code: EDNSOptionCode(optionCode),
+			Data: append([]byte(nil), optionData...),
+		})
+	}
+
+	return OPTRecord{
+		Name:     domainName,
+		UDPSize:  class,
+		ExtRCODE: uint8((ttl & 0xFF000000) >> 24),
+		Version:  uint8((ttl & 0x00FF0000) >> 16),
+		DO:       (ttl & 0x00008000) != 0,
+		Z:        uint16(ttl & 0x00007FFF),
+		Options:  options,
+	}, nil
 }
@@ -0,0 +1,112 @@
+package dns
+
+import "fmt"
+
+// Section identifies a part of a DNS message.
+type Section uint8
+
+var SectionType = struct {
+	Header     Section
+	Question   Section
+	Answer     Section
+	Authority  Section
+	Additional Section
+}{
+	Header:     0,
+	Question:   1,
+	Answer:     2,
+	Authority:  3,
+	Additional: 4,
+}
+
+var SectionName = map[Section]string{
+	SectionType.Header:     "header",
+	SectionType.Question:   "question",
+	SectionType.Answer:     "answer",
+	SectionType.Authority:  "authority",
+	SectionType.Additional: "additional",
+}
+
+func (s Section) String() string {
+	val, ok := SectionName[s]
+	if ok {
+		return val
+	}
+	return fmt.Sprintf("section %d", uint8(s))
+}
+
+// ParseErrorReason tells what was wrong with a malformed message.
+type ParseErrorReason uint8
+
+var ParseErrorReasonType = struct {
+	ShortMessage    ParseErrorReason
+	CountMismatch   ParseErrorReason
+	InvalidName     ParseErrorReason
+	InvalidPointer  ParseErrorReason
+	InvalidRDLength ParseErrorReason
+	InvalidRDATA    ParseErrorReason
+	InvalidOPT      ParseErrorReason
+	TrailingData    ParseErrorReason
+}{
+	ShortMessage:    0,
+	CountMismatch:   1,
+	InvalidName:     2,
+	InvalidPointer:  3,
+	InvalidRDLength: 4,
+	InvalidRDATA:    5,
+	InvalidOPT:      6,
+	TrailingData:    7,
+}
+
+var ParseErrorReasonName = map[ParseErrorReason]string{
+	ParseErrorReasonType.ShortMessage:    "message ends unexpectedly",
+	ParseErrorReasonType.CountMismatch:   "header count exceeds the entries in the message",
+	ParseErrorReasonType.InvalidName:     "invalid domain name",
+	ParseErrorReasonType.InvalidPointer:  "invalid compression pointer",
+	ParseErrorReasonType.InvalidRDLength: "RDLENGTH runs past the end of the message",
+	ParseErrorReasonType.InvalidRDATA:    "invalid RDATA",
+	ParseErrorReasonType.InvalidOPT:      "invalid OPT record",
+	ParseErrorReasonType.TrailingData:    "unexpected data after the last record",
+}
+
+func (r ParseErrorReason) String() string {
+	val, ok := ParseErrorReasonName[r]
+	if ok {
+		return val
+	}
+	return fmt.Sprintf("reason %d", uint8(r))
+}
+
+// ParseError describes where and why ParseDNSPacket rejected a message.
+type ParseError struct {
+	Section Section          // Section that was being parsed
+	Index   int              // Position of the question or record within Section
+	Offset  int              // Byte offset into the message where the problem was found
+	Reason  ParseErrorReason // What was wrong
+	Detail  string           // Optional extra information
+}
+
+func newParseError(offset int, reason ParseErrorReason, detail string) *ParseError {
+	return &ParseError{Offset: offset, Reason: reason, Detail: detail}
+}
+
+func (e *ParseError) Error() string {
+	where := e.Section.String()
+	if e.Section != SectionType.Header {
+		where = fmt.Sprintf("%s %d", where, e.Index)
+	}
+	msg := fmt.Sprintf("malformed %s at offset %d: %s", where, e.Offset, e.Reason)
+	if e.Detail != "" {
+		msg += " (" + e.Detail + ")"
+	}
+	return msg
+}
+
+// locate records which entry of the message err was found in.
+func locate(err error, section Section, index int) error {
+	if parseErr, ok := err.(*ParseError); ok {
+		parseErr.Section = section
+		parseErr.Index = index
+	}
+	return err
+}
@@ -0,0 +1,147 @@
+package dns
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestParseTruncated(t *testing.T) {
+	preamble := DNSRecordPreamble{Name: "example.com.", Type: RType.A, Class: ClassType.IN, TTL: 60}
+	packet := DNSPacket{
+		Header:    DNSHeader{ID: 9, QR: 1, TC: 1, QDCOUNT: 1, ANCOUNT: 3},
+		Questions: []DNSQuestion{{Domain: "example.com.", Type: RType.A, Class: ClassType.IN}},
+		Answers: []DNSRecord{
+			ADNSRecord{DNSRecordPreamble: preamble, IP: net.IPv4(192, 0, 2, 1)},
+			ADNSRecord{DNSRecordPreamble: preamble, IP: net.IPv4(192, 0, 2, 2)},
+			ADNSRecord{DNSRecordPreamble: preamble, IP: net.IPv4(192, 0, 2, 3)},
+		},
+	}
+	buf, err := packet.ToBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const answerSize = 16 // Pointer, type, class, TTL, RDLENGTH and address
+
+	tests := []struct {
+		name    string
+		size    int
+		answers int
+	}{
+		{"complete", len(buf), 3},
+		{"last answer cut", len(buf) - 2, 2},
+		{"last answer missing", len(buf) - answerSize, 2},
+		{"only the question", len(buf) - 3*answerSize, 0},
+		{"question cut", len(buf) - 3*answerSize - 2, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := ParseDNSPacket(buf, tt.size)
+			if !errors.Is(err, ErrTruncated) {
+				t.Fatalf("ParseDNSPacket() error = %v, want ErrTruncated", err)
+			}
+			if len(parsed.Answers) != tt.answers || int(parsed.Header.ANCOUNT) != tt.answers {
+				t.Errorf("got %d answers with ANCOUNT %d, want %d", len(parsed.Answers), parsed.Header.ANCOUNT, tt.answers)
+			}
+			if int(parsed.Header.QDCOUNT) != len(parsed.Questions) {
+				t.Errorf("QDCOUNT %d with %d questions", parsed.Header.QDCOUNT, len(parsed.Questions))
+			}
+		})
+	}
+
+	// The same cut without TC is a malformed message.
+	buf[2] &^= 0x02
+	if _, err := ParseDNSPacket(buf, len(buf)-2); err == nil || errors.Is(err, ErrTruncated) {
+		t.Errorf("ParseDNSPacket() of a cut message without TC: error = %v", err)
+	}
+}
+
+// message builds a raw DNS response with the given section counts followed by
+// the parts concatenated.
+func message(qdcount, ancount, arcount byte, parts ...[]byte) []byte {
+	msg := []byte{0, 1, 0x80, 0, 0, qdcount, 0, ancount, 0, 0, 0, arcount}
+	for _, part := range parts {
+		msg = append(msg, part...)
+	}
+	return msg
+}
+
+// resourceRecord builds a record with class IN and TTL 60 in wire format.
+func resourceRecord(name []byte, recordType RecordType, rdata []byte) []byte {
+	rr := append([]byte(nil), name...)
+	rr = append(rr, byte(recordType>>8), byte(recordType), 0, 1, 0, 0, 0, 60, byte(len(rdata)>>8), byte(len(rdata)))
+	return append(rr, rdata...)
+}
+
+func TestParseErrors(t *testing.T) {
+	// A question for a. IN A, taking up offsets 12 to 18.
+	question := []byte{1, 'a', 0, 0, 1, 0, 1}
+	root := []byte{0}
+	// Five labels of 63 bytes, the fourth one crosses 255 bytes.
+	longName := append(bytes.Repeat(append([]byte{63}, bytes.Repeat([]byte{'x'}, 63)...), 5), 0)
+
+	tests := []struct {
+		name    string
+		msg     []byte
+		section Section
+		index   int
+		offset  int
+		reason  ParseErrorReason
+	}{
+		{"short header", []byte{0, 1, 0x80, 0, 0}, SectionType.Header, 0, 5, ParseErrorReasonType.ShortMessage},
+		{"missing question", message(2, 0, 0, question), SectionType.Question, 1, 19, ParseErrorReasonType.CountMismatch},
+		{"missing answer", message(1, 1, 0, question), SectionType.Answer, 0, 19, ParseErrorReasonType.CountMismatch},
+		{"question type cut", message(1, 0, 0, []byte{0, 0, 1}), SectionType.Question, 0, 13, ParseErrorReasonType.ShortMessage},
+		{"name runs past the end", message(1, 0, 0, []byte{1, 'a'}), SectionType.Question, 0, 14, ParseErrorReasonType.ShortMessage},
+		{"label runs past the end", message(1, 0, 0, []byte{5, 'a'}), SectionType.Question, 0, 12, ParseErrorReasonType.InvalidName},
+		{"name longer than 255 bytes", message(1, 0, 0, longName, []byte{0, 1, 0, 1}), SectionType.Question, 0, 12 + 64*3, ParseErrorReasonType.InvalidName},
+		{"reserved label type 0x40", message(1, 0, 0, []byte{0x41, 'a', 0, 0, 1, 0, 1}), SectionType.Question, 0, 12, ParseErrorReasonType.InvalidName},
+		{"reserved label type 0x80", message(1, 0, 0, []byte{0x81, 'a', 0, 0, 1, 0, 1}), SectionType.Question, 0, 12, ParseErrorReasonType.InvalidName},
+		{"pointer to itself", message(1, 0, 0, []byte{0xC0, 12, 0, 1, 0, 1}), SectionType.Question, 0, 12, ParseErrorReasonType.InvalidPointer},
+		{"forward pointer", message(1, 0, 0, []byte{0xC0, 14, 0, 0, 1, 0, 1}), SectionType.Question, 0, 12, ParseErrorReasonType.InvalidPointer},
+		{"pointer loop", message(1, 0, 0, []byte{1, 'a', 0xC0, 12, 0, 1, 0, 1}), SectionType.Question, 0, 14, ParseErrorReasonType.InvalidPointer},
+		{"pointer cut", message(1, 0, 0, []byte{0xC0}), SectionType.Question, 0, 12, ParseErrorReasonType.InvalidPointer},
+		{"RDLENGTH past the end", message(1, 1, 0, question, resourceRecord(root, RType.A, []byte{192, 0, 2, 1})[:13]), SectionType.Answer, 0, 28, ParseErrorReasonType.InvalidRDLength},
+		{"A record of 3 bytes", message(1, 1, 0, question, resourceRecord(root, RType.A, []byte{192, 0, 2})), SectionType.Answer, 0, 30, ParseErrorReasonType.InvalidRDATA},
+		{"AAAA record of 4 bytes", message(1, 1, 0, question, resourceRecord(root, RType.AAAA, []byte{192, 0, 2, 1})), SectionType.Answer, 0, 30, ParseErrorReasonType.InvalidRDATA},
+		{"NS RDATA longer than the name", message(1, 1, 0, question, resourceRecord(root, RType.NS, []byte{0, 0xFF})), SectionType.Answer, 0, 31, ParseErrorReasonType.InvalidRDATA},
+		{"NS name past the RDATA", message(1, 1, 0, question, resourceRecord(root, RType.NS, []byte{1, 'a'}), []byte{0}), SectionType.Answer, 0, 32, ParseErrorReasonType.ShortMessage},
+		{"NS empty RDATA", message(1, 1, 0, question, resourceRecord(root, RType.NS, nil)), SectionType.Answer, 0, 30, ParseErrorReasonType.InvalidRDATA},
+		{"forward pointer in RDATA", message(1, 1, 0, question, resourceRecord(root, RType.CNAME, []byte{0xC0, 30})), SectionType.Answer, 0, 30, ParseErrorReasonType.InvalidPointer},
+		{"MX too short", message(1, 1, 0, question, resourceRecord(root, RType.MX, []byte{0, 10})), SectionType.Answer, 0, 30, ParseErrorReasonType.InvalidRDATA},
+		{"SOA too short", message(1, 1, 0, question, resourceRecord(root, RType.SOA, []byte{0, 0, 1, 2, 3})), SectionType.Answer, 0, 32, ParseErrorReasonType.InvalidRDATA},
+		{"OPT owner not the root", message(1, 0, 1, question, resourceRecord([]byte{1, 'a', 0}, RType.OPT, nil)), SectionType.Additional, 0, 19, ParseErrorReasonType.InvalidOPT},
+		{"OPT option header cut", message(1, 0, 1, question, resourceRecord(root, RType.OPT, []byte{0, 1})), SectionType.Additional, 0, 30, ParseErrorReasonType.InvalidOPT},
+		{"OPT option length past the RDATA", message(1, 0, 1, question, resourceRecord(root, RType.OPT, []byte{0, 1, 0, 5, 1})), SectionType.Additional, 0, 32, ParseErrorReasonType.InvalidOPT},
+		{"trailing data", message(1, 0, 0, question, []byte{0}), SectionType.Additional, 0, 19, ParseErrorReasonType.TrailingData},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packet, err := ParseDNSPacket(tt.msg, len(tt.msg))
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("ParseDNSPacket() error = %v, want a *ParseError", err)
+			}
+			if parseErr.Section != tt.section || parseErr.Index != tt.index || parseErr.Offset != tt.offset || parseErr.Reason != tt.reason {
+				t.Errorf("got %s %d at offset %d (%s), want %s %d at offset %d (%s)",
+					parseErr.Section, parseErr.Index, parseErr.Offset, parseErr.Reason, tt.section, tt.index, tt.offset, tt.reason)
+			}
+			if (packet == nil) != (tt.section == SectionType.Header) {
+				t.Errorf("packet = %v, want one whenever the header was read", packet)
+			}
+		})
+	}
+}
+
+func TestParseErrorKeepsParsedEntries(t *testing.T) {
+	answer := resourceRecord([]byte{0xC0, 12}, RType.A, []byte{192, 0, 2, 1})
+	msg := message(1, 2, 0, []byte{1, 'a', 0, 0, 1, 0, 1}, answer, answer[:5])
+	packet, err := ParseDNSPacket(msg, len(msg))
+	if err == nil {
+		t.Fatal("ParseDNSPacket() accepted a cut record")
+	}
+	if len(packet.Questions) != 1 || len(packet.Answers) != 1 {
+		t.Errorf("kept %d questions and %d answers, want 1 and 1", len(packet.Questions), len(packet.Answers))
+	}
+}
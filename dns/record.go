@@ -23,8 +23,11 @@ var RType = struct {
 	TXT   RecordType
 	AAAA  RecordType
 	SRV   RecordType
+	DNAME RecordType
 	OPT   RecordType
 	CAA   RecordType
+	IXFR  RecordType
+	AXFR  RecordType
 	ANY   RecordType
 }{
 	A:     1,
@@ -45,8 +48,11 @@ var RType = struct {
 	TXT:   16,
 	AAAA:  28,
 	SRV:   33,
+	DNAME: 39,
 	OPT:   41,
 	CAA:   257,
+	IXFR:  251,
+	AXFR:  252,
 	ANY:   255,
 }
 
@@ -69,8 +75,11 @@ var RecordName = map[RecordType]string{
 	RType.TXT:   "TXT",
 	RType.AAAA:  "AAAA",
 	RType.SRV:   "SRV",
+	RType.DNAME: "DNAME",
 	RType.OPT:   "OPT",
 	RType.CAA:   "CAA",
+	RType.IXFR:  "IXFR",
+	RType.AXFR:  "AXFR",
 	RType.ANY:   "ANY",
 }
 
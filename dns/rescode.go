@@ -1,6 +1,9 @@
 package dns
 
-type DNSResponseCode uint8
+// DNSResponseCode is the effective 12 bit response code of a message. The
+// lower 4 bits travel in the header and the upper 8 bits in the OPT record
+// (RFC 6891), so codes above 15 can only be sent in EDNS messages.
+type DNSResponseCode uint16
 
 var DNSResponseCodeType = struct {
 	NoError        DNSResponseCode
@@ -9,9 +12,21 @@ var DNSResponseCodeType = struct {
 	NameError      DNSResponseCode
 	NotImplemented DNSResponseCode
 	Refused        DNSResponseCode
+	YXDomain       DNSResponseCode
+	YXRRSet        DNSResponseCode
+	NXRRSet        DNSResponseCode
+	NotAuth        DNSResponseCode
+	NotZone        DNSResponseCode
+	DSOTypeNI      DNSResponseCode
+	BadVersion     DNSResponseCode
 	BadSignature   DNSResponseCode
 	BadKey         DNSResponseCode
 	BadTime        DNSResponseCode
+	BadMode        DNSResponseCode
+	BadName        DNSResponseCode
+	BadAlgorithm   DNSResponseCode
+	BadTruncation  DNSResponseCode
+	BadCookie      DNSResponseCode
 }{
 	NoError:        0,
 	FormatError:    1,
@@ -19,9 +34,21 @@ var DNSResponseCodeType = struct {
 	NameError:      3,
 	NotImplemented: 4,
 	Refused:        5,
-	BadSignature:   6,
-	BadKey:         7,
-	BadTime:        8,
+	YXDomain:       6,
+	YXRRSet:        7,
+	NXRRSet:        8,
+	NotAuth:        9,
+	NotZone:        10,
+	DSOTypeNI:      11,
+	BadVersion:     16,
+	BadSignature:   16, // Shares its value with BadVersion, TSIG uses it in the TSIG record
+	BadKey:         17,
+	BadTime:        18,
+	BadMode:        19,
+	BadName:        20,
+	BadAlgorithm:   21,
+	BadTruncation:  22,
+	BadCookie:      23,
 }
 
 func (r DNSResponseCode) String() string {
@@ -38,12 +65,34 @@ func (r DNSResponseCode) String() string {
 		return "NotImplemented"
 	case DNSResponseCodeType.Refused:
 		return "Refused"
-	case DNSResponseCodeType.BadSignature:
-		return "BadSignature"
+	case DNSResponseCodeType.YXDomain:
+		return "YXDomain"
+	case DNSResponseCodeType.YXRRSet:
+		return "YXRRSet"
+	case DNSResponseCodeType.NXRRSet:
+		return "NXRRSet"
+	case DNSResponseCodeType.NotAuth:
+		return "NotAuth"
+	case DNSResponseCodeType.NotZone:
+		return "NotZone"
+	case DNSResponseCodeType.DSOTypeNI:
+		return "DSOTypeNI"
+	case DNSResponseCodeType.BadVersion:
+		return "BadVersion"
 	case DNSResponseCodeType.BadKey:
 		return "BadKey"
 	case DNSResponseCodeType.BadTime:
 		return "BadTime"
+	case DNSResponseCodeType.BadMode:
+		return "BadMode"
+	case DNSResponseCodeType.BadName:
+		return "BadName"
+	case DNSResponseCodeType.BadAlgorithm:
+		return "BadAlgorithm"
+	case DNSResponseCodeType.BadTruncation:
+		return "BadTruncation"
+	case DNSResponseCodeType.BadCookie:
+		return "BadCookie"
 	default:
 		return "Unknown Response Code"
 	}
@@ -0,0 +1,81 @@
+package dns
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	reverseIPv4Zone Name = "in-addr.arpa."
+	reverseIPv6Zone Name = "ip6.arpa."
+)
+
+// ReverseName returns the in-addr.arpa or ip6.arpa name under which the PTR
+// record of ip is published, e.g. 4.0.41.198.in-addr.arpa. for 198.41.0.4.
+func ReverseName(ip net.IP) (Name, error) {
+	if ip4 := ip.To4(); ip4 != nil {
+		return Name(fmt.Sprintf("%d.%d.%d.%d.%s", ip4[3], ip4[2], ip4[1], ip4[0], reverseIPv4Zone)), nil
+	}
+
+	ip6 := ip.To16()
+	if ip6 == nil {
+		return "", errors.New("invalid IP address")
+	}
+
+	digits := hex.EncodeToString(ip6)
+	var name strings.Builder
+	for i := len(digits) - 1; i >= 0; i-- {
+		name.WriteByte(digits[i])
+		name.WriteByte('.')
+	}
+	name.WriteString(string(reverseIPv6Zone))
+	return Name(name.String()), nil
+}
+
+// IPFromReverseName is the inverse of ReverseName. It only accepts names
+// that describe a complete address.
+func IPFromReverseName(name Name) (net.IP, error) {
+	labels := name.Labels()
+
+	switch {
+	case name.IsSubdomainOf(reverseIPv4Zone):
+		labels = labels[:len(labels)-reverseIPv4Zone.CountLabels()]
+		if len(labels) != 4 {
+			return nil, fmt.Errorf("%s does not name a complete IPv4 address", name)
+		}
+		ip := make(net.IP, 4)
+		for i, label := range labels {
+			octet, err := strconv.ParseUint(label, 10, 8)
+			if err != nil || (len(label) > 1 && label[0] == '0') {
+				return nil, fmt.Errorf("invalid octet %q in %s", label, name)
+			}
+			ip[3-i] = byte(octet)
+		}
+		return ip, nil
+
+	case name.IsSubdomainOf(reverseIPv6Zone):
+		labels = labels[:len(labels)-reverseIPv6Zone.CountLabels()]
+		if len(labels) != 32 {
+			return nil, fmt.Errorf("%s does not name a complete IPv6 address", name)
+		}
+		digits := make([]byte, 32)
+		for i, label := range labels {
+			if len(label) != 1 {
+				return nil, fmt.Errorf("invalid nibble %q in %s", label, name)
+			}
+			digits[31-i] = label[0]
+		}
+		ip, err := hex.DecodeString(string(digits))
+		if err != nil {
+			return nil, fmt.Errorf("invalid nibble in %s", name)
+		}
+		return net.IP(ip), nil
+
+	default:
+		return nil, fmt.Errorf("%s is not a reverse lookup name", name)
+	}
+}
@@ -0,0 +1,79 @@
+package dns
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestReverseNameRoundTrip(t *testing.T) {
+	tests := []struct {
+		ip   string
+		name Name
+	}{
+		{"198.41.0.4", "4.0.41.198.in-addr.arpa."},
+		{"0.0.0.0", "0.0.0.0.in-addr.arpa."},
+		{"255.255.255.255", "255.255.255.255.in-addr.arpa."},
+		{"2001:db8::567:89ab", "b.a.9.8.7.6.5.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa."},
+		{"::", Name(strings.Repeat("0.", 32) + "ip6.arpa.")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			ip := net.ParseIP(tt.ip)
+			name, err := ReverseName(ip)
+			if err != nil {
+				t.Fatalf("ReverseName(%s) error = %v", tt.ip, err)
+			}
+			if name != tt.name {
+				t.Errorf("ReverseName(%s) = %s, want %s", tt.ip, name, tt.name)
+			}
+			back, err := IPFromReverseName(name)
+			if err != nil {
+				t.Fatalf("IPFromReverseName(%s) error = %v", name, err)
+			}
+			if !back.Equal(ip) {
+				t.Errorf("IPFromReverseName(%s) = %s, want %s", name, back, tt.ip)
+			}
+		})
+	}
+
+	if _, err := ReverseName(net.IP{1, 2, 3}); err == nil {
+		t.Error("ReverseName accepted a 3 byte address")
+	}
+}
+
+func TestIPFromReverseName(t *testing.T) {
+	tests := []struct {
+		name    Name
+		want    string
+		wantErr bool
+	}{
+		{"4.0.41.198.IN-ADDR.ARPA.", "198.41.0.4", false},
+		{"4.0.41.198.in-addr.arpa", "198.41.0.4", false},
+		{"B.A.9.8.7.6.5.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.B.D.0.1.0.0.2.ip6.arpa.", "2001:db8::567:89ab", false},
+		{"0.41.198.in-addr.arpa.", "", true},
+		{"1.4.0.41.198.in-addr.arpa.", "", true},
+		{"in-addr.arpa.", "", true},
+		{"256.0.41.198.in-addr.arpa.", "", true},
+		{"04.0.41.198.in-addr.arpa.", "", true},
+		{"x.0.41.198.in-addr.arpa.", "", true},
+		{"0/25.0.41.198.in-addr.arpa.", "", true},
+		{Name(strings.Repeat("0.", 31) + "ip6.arpa."), "", true},
+		{Name(strings.Repeat("0.", 33) + "ip6.arpa."), "", true},
+		{Name("g." + strings.Repeat("0.", 31) + "ip6.arpa."), "", true},
+		{Name("00." + strings.Repeat("0.", 31) + "ip6.arpa."), "", true},
+		{"www.example.com.", "", true},
+		{".", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.name), func(t *testing.T) {
+			got, err := IPFromReverseName(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("IPFromReverseName(%s) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			}
+			if !tt.wantErr && !got.Equal(net.ParseIP(tt.want)) {
+				t.Errorf("IPFromReverseName(%s) = %s, want %s", tt.name, got, tt.want)
+			}
+		})
+	}
+}
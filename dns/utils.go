@@ -2,74 +2,190 @@ package dns
 
 import (
 	"encoding/binary"
-	"errors"
+	"fmt"
 	"math"
 	"strings"
 )
 
-func encodeDomainName(name string, offsetMap map[string]uint, currentOffset uint) []byte {
+// maxLabelLength is the longest label allowed in a name (RFC 1035 section 2.3.4).
+const maxLabelLength = 63
+
+// maxPointerOffset is the largest offset a compression pointer can hold.
+const maxPointerOffset = 0x3FFF
+
+// splitName splits a name in presentation format into its labels, undoing
+// \. and \DDD escapes. The root label is not included.
+func splitName(name string) ([]string, error) {
 	if name == "." || name == "" {
-		return []byte{0x00}
+		return nil, nil
+	}
+	var labels []string
+	var label []byte
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch c {
+		case '.':
+			if len(label) == 0 {
+				return nil, fmt.Errorf("invalid domain name %q: empty label", name)
+			}
+			labels = append(labels, string(label))
+			label = nil
+		case '\\':
+			if i+1 >= len(name) {
+				return nil, fmt.Errorf("invalid domain name %q: trailing backslash", name)
+			}
+			if isDigit(name[i+1]) {
+				if i+3 >= len(name) || !isDigit(name[i+2]) || !isDigit(name[i+3]) {
+					return nil, fmt.Errorf("invalid domain name %q: \\DDD escape needs three digits", name)
+				}
+				value := int(name[i+1]-'0')*100 + int(name[i+2]-'0')*10 + int(name[i+3]-'0')
+				if value > 255 {
+					return nil, fmt.Errorf("invalid domain name %q: \\%s is not a byte", name, name[i+1:i+4])
+				}
+				label = append(label, byte(value))
+				i += 3
+			} else {
+				label = append(label, name[i+1])
+				i++
+			}
+		default:
+			label = append(label, c)
+		}
+	}
+	if len(label) > 0 {
+		labels = append(labels, string(label))
+	}
+	return labels, nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// escapeLabel returns label in presentation format. Dots and backslashes are
+// escaped with a backslash and bytes that are not printable ASCII as \DDD.
+func escapeLabel(label []byte) string {
+	var sb strings.Builder
+	for _, c := range label {
+		switch {
+		case c == '.' || c == '\\':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		case c < 0x21 || c > 0x7E:
+			fmt.Fprintf(&sb, "\\%03d", c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
+
+// encodeDomainName writes name in wire format, compressing it against the
+// names already in offsetMap. Names are validated against the RFC 1035 limits.
+func encodeDomainName(name Name, offsetMap map[string]uint, currentOffset uint) ([]byte, error) {
+	labels, err := splitName(string(name))
+	if err != nil {
+		return nil, err
+	}
+	nameLength := 1 // The root label
+	escaped := make([]string, len(labels))
+	for i, label := range labels {
+		if len(label) > maxLabelLength {
+			return nil, fmt.Errorf("invalid domain name %q: label longer than %d bytes", name, maxLabelLength)
+		}
+		nameLength += len(label) + 1
+		escaped[i] = escapeLabel([]byte(label))
 	}
-	trimmed := strings.TrimSuffix(name, ".")
-	labels := strings.Split(trimmed, ".")
+	if nameLength > maxNameLength {
+		return nil, fmt.Errorf("invalid domain name %q: longer than %d bytes", name, maxNameLength)
+	}
+
 	var buf []byte
 	for i, label := range labels {
-		suffix := strings.Join(labels[i:], ".")
+		suffix := strings.Join(escaped[i:], ".")
 		if pointer, ok := offsetMap[suffix]; ok {
 			// If the domain name is already encoded, use a compression pointer
 			offSet := 0xC000 | pointer
 			pointerBytes := make([]byte, 2)
 			binary.BigEndian.PutUint16(pointerBytes, uint16(offSet))
 			buf = append(buf, pointerBytes...)
-			return buf
+			return buf, nil
 		}
 		length := len(label)
 		buf = append(buf, byte(length))
 		buf = append(buf, []byte(label)...)
-		offsetMap[suffix] = currentOffset
+		// Names past the reach of a pointer cannot be used for compression.
+		if currentOffset <= maxPointerOffset {
+			offsetMap[suffix] = currentOffset
+		}
 		currentOffset += uint(length + 1) // +1 for the length byte
 	}
 	buf = append(buf, 0x00)
-	return buf
+	return buf, nil
 }
 
 func checkBits(value uint, numBits uint) bool {
 	return value <= uint(math.Pow(2, float64(numBits)))
 }
 
-func decodeDomainName(encodedDomainName []byte, start int) (string, int, error) {
+// maxNameLength is the longest wire form of a name, including the length
+// bytes and the root label (RFC 1035 section 2.3.4).
+const maxNameLength = 255
+
+// decodeDomainName reads the possibly compressed name at start. Besides the
+// name it returns the offset of the last byte the name occupies at start:
+// the terminating zero, or the second byte of the first compression pointer.
+// Pointers must point before the labels that led to them, which rules out
+// loops and forward references, and names are limited to RFC 1035 lengths.
+// Labels are returned in presentation format, see escapeLabel.
+func decodeDomainName(encodedDomainName []byte, start int) (Name, int, error) {
 	var parts []string
+	nameLength := 1 // The root label
+	end := -1
+	segmentStart := start
 	i := start
-	for ; i < len(encodedDomainName) && encodedDomainName[i] != 0; i++ {
-		partLength := uint(encodedDomainName[i])
 
-		if partLength&0xC0 == 0xC0 {
-			// This is a compression pointer to another compression pointer
+	for {
+		if i >= len(encodedDomainName) {
+			return "", -1, newParseError(i, ParseErrorReasonType.ShortMessage, "name runs past the end of the message")
+		}
+		partLength := int(encodedDomainName[i])
+
+		switch partLength & 0xC0 {
+		case 0x00:
+			if partLength == 0 {
+				if end < 0 {
+					end = i
+				}
+				return Name(strings.Join(parts, ".") + "."), end, nil
+			}
+			if i+partLength >= len(encodedDomainName) {
+				return "", -1, newParseError(i, ParseErrorReasonType.InvalidName, "label runs past the end of the message")
+			}
+			nameLength += partLength + 1
+			if nameLength > maxNameLength {
+				return "", -1, newParseError(i, ParseErrorReasonType.InvalidName, "name longer than 255 bytes")
+			}
+			parts = append(parts, escapeLabel(encodedDomainName[i+1:i+partLength+1]))
+			i += partLength + 1
+
+		case 0xC0:
 			if i+1 >= len(encodedDomainName) {
-				return "", -1, errors.New("Compression pointer out of bounds")
+				return "", -1, newParseError(i, ParseErrorReasonType.InvalidPointer, "pointer out of bounds")
 			}
 			offset := int(binary.BigEndian.Uint16(encodedDomainName[i:i+2]) & 0x3FFF)
-			if offset >= len(encodedDomainName) || offset < 0 {
-				return "", -1, errors.New("Invalid compression pointer")
+			if offset >= segmentStart {
+				return "", -1, newParseError(i, ParseErrorReasonType.InvalidPointer, "pointer does not point backwards")
 			}
-			if encodedDomainName[offset]&0xC0 == 0xC0 {
-				return "", -1, errors.New("Invalid compression pointer to another compression pointer")
+			if end < 0 {
+				end = i + 1
 			}
-			value, _, err := decodeDomainName(encodedDomainName, offset)
-			if err != nil {
-				return "", -1, err
-			}
-			parts = append(parts, value)
-			return strings.Join(parts, "."), i + 1, nil
-		}
+			segmentStart = offset
+			i = offset
 
-		if i+int(partLength) >= len(encodedDomainName) {
-			return "", -1, errors.New("Invalid Encoded Domain name")
+		default:
+			// 0x40 and 0x80 are reserved label types, they also cap labels at 63 bytes.
+			return "", -1, newParseError(i, ParseErrorReasonType.InvalidName, "reserved label type")
 		}
-		part := encodedDomainName[i+1 : i+int(partLength)+1]
-		parts = append(parts, string(part))
-		i = i + int(partLength)
 	}
-	return strings.Join(parts, ".") + ".", i, nil
 }
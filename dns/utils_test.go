@@ -0,0 +1,139 @@
+package dns
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNameWireRoundTrip(t *testing.T) {
+	tests := []struct {
+		name Name
+		want Name // Presentation form after decoding
+	}{
+		{".", "."},
+		{"example.com", "example.com."},
+		{"Example.COM.", "Example.COM."},
+		{`a\.b.example.`, `a\.b.example.`},
+		{`a\046b.example.`, `a\.b.example.`},
+		{`back\\slash.example.`, `back\\slash.example.`},
+		{`sp\032ace.example.`, `sp\032ace.example.`},
+		{`\000\255.example.`, `\000\255.example.`},
+		{`\065bc.example.`, "Abc.example."},
+		{`q\"uote.example.`, `q"uote.example.`},
+		{"_srv._tcp.example.", "_srv._tcp.example."},
+		{Name(strings.Repeat("x", 63) + ".example."), Name(strings.Repeat("x", 63) + ".example.")},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.name), func(t *testing.T) {
+			packet := DNSPacket{
+				Header: DNSHeader{ID: 1, QR: 1, QDCOUNT: 1, ANCOUNT: 1},
+				Questions: []DNSQuestion{
+					{Domain: tt.name, Type: RType.CNAME, Class: ClassType.IN},
+				},
+				Answers: []DNSRecord{
+					// The target shares the name as a suffix and gets compressed.
+					CNAMERecord{DNSRecordPreamble: DNSRecordPreamble{Name: tt.name, Type: RType.CNAME, Class: ClassType.IN, TTL: 60}, CanonicalName: nameFromRawLabels(append([]string{"www"}, tt.name.rawLabels()...))},
+				},
+			}
+			buf, err := packet.ToBytes()
+			if err != nil {
+				t.Fatalf("ToBytes() error = %v", err)
+			}
+			parsed, err := ParseDNSPacket(buf, len(buf))
+			if err != nil {
+				t.Fatalf("ParseDNSPacket() error = %v", err)
+			}
+			if got := parsed.Questions[0].Domain; got != tt.want {
+				t.Errorf("question name = %q, want %q", got, tt.want)
+			}
+			answer := parsed.Answers[0].(CNAMERecord)
+			if answer.Name != tt.want {
+				t.Errorf("owner name = %q, want %q", answer.Name, tt.want)
+			}
+			if !answer.CanonicalName.EqualCase(packet.Answers[0].(CNAMERecord).CanonicalName) {
+				t.Errorf("target = %q, want %q", answer.CanonicalName, packet.Answers[0].(CNAMERecord).CanonicalName)
+			}
+		})
+	}
+}
+
+func TestEncodeDomainNameErrors(t *testing.T) {
+	tests := []Name{
+		"a..example.",
+		"..",
+		`trailing\`,
+		`short\12.example.`,
+		`short\1.example.`,
+		`big\256.example.`,
+		Name(strings.Repeat("x", 64) + ".example."),
+		Name(strings.Repeat(strings.Repeat("x", 63)+".", 4)),
+	}
+	for _, name := range tests {
+		t.Run(string(name), func(t *testing.T) {
+			if buf, err := encodeDomainName(name, make(map[string]uint), 12); err == nil {
+				t.Errorf("encodeDomainName(%q) = % x, want an error", name, buf)
+			}
+		})
+	}
+
+	// 3 labels of 63 bytes and one of 61 are exactly 255 bytes on the wire.
+	longest := Name(strings.Repeat(strings.Repeat("x", 63)+".", 3) + strings.Repeat("x", 61) + ".")
+	buf, err := encodeDomainName(longest, make(map[string]uint), 12)
+	if err != nil || len(buf) != maxNameLength {
+		t.Errorf("encodeDomainName() of a 255 byte name = %d bytes, %v", len(buf), err)
+	}
+}
+
+func TestEncodeDomainNameCompression(t *testing.T) {
+	offsetMap := make(map[string]uint)
+	if _, err := encodeDomainName("www.example.com.", offsetMap, 12); err != nil {
+		t.Fatal(err)
+	}
+	// Suffixes compare by their escaped labels, case included.
+	buf, err := encodeDomainName("mail.example.com.", offsetMap, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{4, 'm', 'a', 'i', 'l', 0xC0, 16}; string(buf) != string(want) {
+		t.Errorf("encodeDomainName() = % x, want % x", buf, want)
+	}
+	buf, err = encodeDomainName(`a\.example.com.`, offsetMap, 40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{9, 'a', '.', 'e', 'x', 'a', 'm', 'p', 'l', 'e', 0xC0, 24}; string(buf) != string(want) {
+		t.Errorf("encodeDomainName() = % x, want % x", buf, want)
+	}
+
+	// Names past the reach of a pointer are not remembered.
+	offsetMap = make(map[string]uint)
+	if _, err := encodeDomainName("far.example.", offsetMap, maxPointerOffset+1); err != nil {
+		t.Fatal(err)
+	}
+	if len(offsetMap) != 0 {
+		t.Errorf("offsets past 0x3FFF recorded: %v", offsetMap)
+	}
+}
+
+func TestEscapeLabel(t *testing.T) {
+	tests := []struct {
+		label string
+		want  string
+	}{
+		{"abc", "abc"},
+		{"a.b", `a\.b`},
+		{`a\b`, `a\\b`},
+		{"a b", `a\032b`},
+		{"\x00\x7f\xff", `\000\127\255`},
+		{"!~", "!~"},
+	}
+	for _, tt := range tests {
+		if got := escapeLabel([]byte(tt.label)); got != tt.want {
+			t.Errorf("escapeLabel(%q) = %q, want %q", tt.label, got, tt.want)
+		}
+		labels, err := splitName(tt.want)
+		if err != nil || len(labels) != 1 || labels[0] != tt.label {
+			t.Errorf("splitName(%q) = %q, %v, want [%q]", tt.want, labels, err, tt.label)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/rounakkumarsingh/dns-server/dns"
+)
+
+// minUDPSize is the largest UDP message every client must accept (RFC 1035).
+const minUDPSize = 512
+
+// ednsVersion is the highest EDNS version this server implements.
+const ednsVersion = 0
+
+// ServerUDPSize is the EDNS UDP payload size advertised to clients. 1232 bytes
+// avoids IP fragmentation on virtually every path (DNS Flag Day 2020).
+var ServerUDPSize uint16 = 1232
+
+// UpstreamUDPSize is the EDNS UDP payload size advertised in queries sent to
+// other servers.
+var UpstreamUDPSize uint16 = 1232
+
+// DNSSECValidation asks upstream servers for DNSSEC records by setting the DO
+// bit in outgoing queries.
+var DNSSECValidation = false
+
+// noEDNSMemory is how long we keep talking plain DNS to a server that
+// rejected an EDNS query before trying EDNS with it again.
+const noEDNSMemory = time.Hour
+
+// ednsTracker remembers which upstream servers do not understand EDNS.
+type ednsTracker struct {
+	mu          sync.Mutex
+	unsupported map[string]time.Time
+}
+
+var upstreamEDNS = &ednsTracker{unsupported: make(map[string]time.Time)}
+
+// supported reports whether queries to ip should carry an OPT record.
+func (t *ednsTracker) supported(ip net.IP) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	since, ok := t.unsupported[ip.String()]
+	if !ok {
+		return true
+	}
+	if time.Since(since) > noEDNSMemory {
+		delete(t.unsupported, ip.String())
+		return true
+	}
+	return false
+}
+
+// markUnsupported makes subsequent queries to ip use plain DNS.
+func (t *ednsTracker) markUnsupported(ip net.IP) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.unsupported[ip.String()] = time.Now()
+}
+
+// withEDNS returns a copy of query with our OPT record added.
+func withEDNS(query dns.DNSPacket) dns.DNSPacket {
+	opt := dns.OPTRecord{Name: ".", UDPSize: UpstreamUDPSize, Version: ednsVersion, DO: DNSSECValidation}
+	additional := make([]dns.DNSRecord, 0, len(query.Additional)+1)
+	query.Additional = append(append(additional, query.Additional...), opt)
+	query.Header.ARCOUNT = uint16(len(query.Additional))
+	return query
+}
+
+// queryWithEDNS sends queryPacket to dnsServer with an OPT record unless the
+// server is known not to support EDNS, and falls back to plain DNS when the
+// server rejects the OPT record. exactCase is passed on to query.
+func queryWithEDNS(dnsServer net.IP, queryPacket dns.DNSPacket, timeout time.Duration, exactCase bool) (*dns.DNSPacket, error) {
+	if !upstreamEDNS.supported(dnsServer) {
+		return query(dnsServer, queryPacket, timeout, exactCase)
+	}
+
+	responsePacket, err := query(dnsServer, withEDNS(queryPacket), timeout, exactCase)
+	if err != nil {
+		return nil, err
+	}
+	if rejectsEDNS(responsePacket) {
+		log.Printf("Server %s rejected EDNS, falling back to plain DNS", dnsServer)
+		upstreamEDNS.markUnsupported(dnsServer)
+		return query(dnsServer, queryPacket, timeout, exactCase)
+	}
+	return responsePacket, nil
+}
+
+// rejectsEDNS reports whether a response to an EDNS query means the server
+// does not implement EDNS: it answered FORMERR or NOTIMP without an OPT record
+// of its own (RFC 6891 section 7).
+func rejectsEDNS(responsePacket *dns.DNSPacket) bool {
+	rcode := responsePacket.Header.RCODE
+	if rcode != dns.DNSResponseCodeType.FormatError && rcode != dns.DNSResponseCodeType.NotImplemented {
+		return false
+	}
+	opt, err := findOPT(responsePacket)
+	return err == nil && opt == nil
+}
+
+var errMultipleOPT = errors.New("more than one OPT record")
+
+// findOPT returns the OPT record of a message, or nil when the sender does not
+// use EDNS. A message with several OPT records is malformed (RFC 6891).
+func findOPT(packet *dns.DNSPacket) (*dns.OPTRecord, error) {
+	var opt *dns.OPTRecord
+	for _, additionalRecord := range packet.Additional {
+		if record, ok := additionalRecord.(dns.OPTRecord); ok {
+			if opt != nil {
+				return nil, errMultipleOPT
+			}
+			opt = &record
+		}
+	}
+	return opt, nil
+}
+
+// clientUDPSize returns the largest UDP response we may send to a client,
+// given the OPT record of its query.
+func clientUDPSize(clientOPT *dns.OPTRecord) int {
+	if clientOPT == nil {
+		return minUDPSize
+	}
+	return int(min(max(clientOPT.UDPSize, minUDPSize), ServerUDPSize))
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/rounakkumarsingh/dns-server/dns"
+)
+
+func TestClientUDPSize(t *testing.T) {
+	defer func(size uint16) { ServerUDPSize = size }(ServerUDPSize)
+	ServerUDPSize = 1232
+
+	tests := []struct {
+		name string
+		opt  *dns.OPTRecord
+		want int
+	}{
+		{"no EDNS", nil, minUDPSize},
+		{"zero", &dns.OPTRecord{UDPSize: 0}, minUDPSize},
+		{"below 512", &dns.OPTRecord{UDPSize: 100}, minUDPSize},
+		{"512", &dns.OPTRecord{UDPSize: 512}, 512},
+		{"within our size", &dns.OPTRecord{UDPSize: 1000}, 1000},
+		{"our size", &dns.OPTRecord{UDPSize: 1232}, 1232},
+		{"above our size", &dns.OPTRecord{UDPSize: 4096}, 1232},
+		{"largest", &dns.OPTRecord{UDPSize: 65535}, 1232},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := clientUDPSize(tt.opt); got != tt.want {
+				t.Errorf("clientUDPSize() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
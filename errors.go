@@ -1,11 +1,54 @@
 package main
 
-import "github.com/rounakkumarsingh/dns-server/dns"
+import (
+	"fmt"
+
+	"github.com/rounakkumarsingh/dns-server/dns"
+)
 
 type RESCODEError struct {
-	Code dns.DNSResponseCode
+	Code          dns.DNSResponseCode
+	ExtendedError *dns.ExtendedErrorOption // Optional explanation for the client (RFC 8914)
 }
 
 func (r RESCODEError) Error() string {
+	if r.ExtendedError != nil {
+		return "DNS Response Code: " + r.Code.String() + " (" + r.ExtendedError.String() + ")"
+	}
 	return "DNS Response Code: " + r.Code.String()
 }
+
+// serverFailure returns a SERVFAIL error that tells the client why resolution
+// failed through an Extended DNS Error.
+func serverFailure(infoCode dns.ExtendedErrorCode, format string, args ...any) RESCODEError {
+	return RESCODEError{
+		Code:          dns.DNSResponseCodeType.ServerFailure,
+		ExtendedError: &dns.ExtendedErrorOption{InfoCode: infoCode, ExtraText: fmt.Sprintf(format, args...)},
+	}
+}
+
+// upstreamError turns an error response from another server into the error
+// reported to our client. NXDOMAIN and YXDOMAIN are passed on as they are.
+// SERVFAIL or REFUSED from every nameserver of a zone is reported as a lame
+// delegation, and any other code, which is about our query to that server
+// rather than the client's, as SERVFAIL. Extended DNS Errors sent by the
+// upstream server are passed on.
+func upstreamError(responsePacket *dns.DNSPacket, zone dns.Name) RESCODEError {
+	rcode := responsePacket.Header.RCODE
+	var err RESCODEError
+	switch rcode {
+	case dns.DNSResponseCodeType.NameError, dns.DNSResponseCodeType.YXDomain:
+		err = RESCODEError{Code: rcode}
+	case dns.DNSResponseCodeType.ServerFailure, dns.DNSResponseCodeType.Refused:
+		err = serverFailure(dns.EDECodeType.NoReachableAuthority, "all nameservers for %s answered %s", zone, rcode)
+	default:
+		err = serverFailure(dns.EDECodeType.Other, "nameserver for %s answered %s", zone, rcode)
+	}
+
+	if opt, _ := findOPT(responsePacket); opt != nil {
+		if ede, _ := opt.ExtendedError(); ede != nil {
+			err.ExtendedError = ede
+		}
+	}
+	return err
+}
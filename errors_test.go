@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/rounakkumarsingh/dns-server/dns"
+)
+
+func TestUpstreamError(t *testing.T) {
+	tests := []struct {
+		rcode    dns.DNSResponseCode
+		wantCode dns.DNSResponseCode
+		wantEDE  dns.ExtendedErrorCode
+		withEDE  bool
+	}{
+		{dns.DNSResponseCodeType.NameError, dns.DNSResponseCodeType.NameError, 0, false},
+		{dns.DNSResponseCodeType.YXDomain, dns.DNSResponseCodeType.YXDomain, 0, false},
+		{dns.DNSResponseCodeType.ServerFailure, dns.DNSResponseCodeType.ServerFailure, dns.EDECodeType.NoReachableAuthority, true},
+		{dns.DNSResponseCodeType.Refused, dns.DNSResponseCodeType.ServerFailure, dns.EDECodeType.NoReachableAuthority, true},
+		{dns.DNSResponseCodeType.FormatError, dns.DNSResponseCodeType.ServerFailure, dns.EDECodeType.Other, true},
+		{dns.DNSResponseCodeType.NotImplemented, dns.DNSResponseCodeType.ServerFailure, dns.EDECodeType.Other, true},
+		{dns.DNSResponseCodeType.NotAuth, dns.DNSResponseCodeType.ServerFailure, dns.EDECodeType.Other, true},
+		{dns.DNSResponseCodeType.BadVersion, dns.DNSResponseCodeType.ServerFailure, dns.EDECodeType.Other, true},
+		{dns.DNSResponseCodeType.BadCookie, dns.DNSResponseCodeType.ServerFailure, dns.EDECodeType.Other, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rcode.String(), func(t *testing.T) {
+			responsePacket := &dns.DNSPacket{Header: dns.DNSHeader{QR: 1, RCODE: tt.rcode}}
+			err := upstreamError(responsePacket, "example.com.")
+			if err.Code != tt.wantCode {
+				t.Errorf("code = %s, want %s", err.Code, tt.wantCode)
+			}
+			if (err.ExtendedError != nil) != tt.withEDE {
+				t.Fatalf("extended error = %v, want one: %v", err.ExtendedError, tt.withEDE)
+			}
+			if tt.withEDE && err.ExtendedError.InfoCode != tt.wantEDE {
+				t.Errorf("extended error = %s, want %s", err.ExtendedError.InfoCode, tt.wantEDE)
+			}
+
+			// Whatever the upstream code, the answer fits a client without
+			// EDNS.
+			clientResponse := dns.DNSPacket{Header: dns.DNSHeader{QR: 1, RCODE: err.Code}}
+			if _, encodeErr := clientResponse.ToBytes(); encodeErr != nil {
+				t.Errorf("response without OPT record: %v", encodeErr)
+			}
+		})
+	}
+
+	// An Extended DNS Error from the upstream server is passed on.
+	upstreamOPT := dns.OPTRecord{UDPSize: 1232}
+	if err := upstreamOPT.SetOption(dns.ExtendedErrorOption{InfoCode: dns.EDECodeType.Prohibited, ExtraText: "not for you"}); err != nil {
+		t.Fatal(err)
+	}
+	responsePacket := &dns.DNSPacket{Header: dns.DNSHeader{QR: 1, RCODE: dns.DNSResponseCodeType.Refused}, Additional: []dns.DNSRecord{upstreamOPT}}
+	err := upstreamError(responsePacket, "example.com.")
+	if err.Code != dns.DNSResponseCodeType.ServerFailure || err.ExtendedError == nil || err.ExtendedError.InfoCode != dns.EDECodeType.Prohibited {
+		t.Errorf("upstreamError() = %v, want SERVFAIL with the upstream EDE", err)
+	}
+}
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 	"log"
 	"math/rand"
@@ -12,31 +14,53 @@ import (
 	"github.com/rounakkumarsingh/dns-server/dns"
 )
 
-var RootServers = map[string][]net.IP{
-	"A": {net.ParseIP("198.41.0.4"), net.ParseIP("2001:503:ba3e::2:30")},
-	"B": {net.ParseIP("199.9.14.201"), net.ParseIP("2801:1b8:10::b")},
-	"C": {net.ParseIP("192.33.4.12"), net.ParseIP("2001:500:2::c")},
-	"D": {net.ParseIP("199.7.91.13"), net.ParseIP("2001:500:2d::d")},
-	"E": {net.ParseIP("192.203.230.10"), net.ParseIP("2001:500:a8::e")},
-	"F": {net.ParseIP("192.5.5.241"), net.ParseIP("2001:500:2f::f")},
-	"G": {net.ParseIP("192.112.36.4"), net.ParseIP("2001:500:12::d0d")},
-	"H": {net.ParseIP("198.97.190.53"), net.ParseIP("2001:500:1::53")},
-	"I": {net.ParseIP("192.36.148.17"), net.ParseIP("2001:7fe::53")},
-	"J": {net.ParseIP("192.58.128.30"), net.ParseIP("2001:503:c27::2:30")},
-	"K": {net.ParseIP("193.0.14.129"), net.ParseIP("2001:7fd::1")},
-	"L": {net.ParseIP("199.7.83.42"), net.ParseIP("2001:500:9f::42")},
-	"M": {net.ParseIP("202.12.27.33"), net.ParseIP("2001:dc3::35")},
-}
+// QueryTimeBudget bounds the total time spent answering a single client query,
+// across every upstream server and referral.
+var QueryTimeBudget = 4 * time.Second
 
-func handlePacket(queryBuffer []byte) (dns.DNSPacket, error) {
+// handlePacket answers a client query. Besides the response it returns the
+// largest UDP message the client is willing to receive.
+func handlePacket(queryBuffer []byte) (dns.DNSPacket, int, error) {
 	dnsQuery, err := dns.ParseDNSPacket(queryBuffer, len(queryBuffer))
+	if dnsQuery == nil {
+		// Without a header there is no ID to answer to.
+		return dns.DNSPacket{}, 0, err
+	}
+
+	if dnsQuery.Header.QR == 1 {
+		// Answering a response could start an endless exchange of errors with
+		// another server, or let us be used to reflect traffic at a victim.
+		return dns.DNSPacket{}, 0, errors.New("ignoring a DNS response sent to the server")
+	}
+
 	if err != nil {
 		log.Println("Failed to parse DNS packet:", err)
-		return dns.DNSPacket{}, err
+		return errorResponse(dnsQuery, dns.DNSResponseCodeType.FormatError), minUDPSize, nil
 	}
 
-	if dnsQuery.Header.QDCOUNT != 1 {
-		return dns.DNSPacket{}, errors.New("Only one question supported") // We only handle single question queries
+	if dnsQuery.Header.OPCODE != 0 {
+		log.Println("Rejecting query with unsupported OPCODE:", dnsQuery.Header.OPCODE)
+		return errorResponse(dnsQuery, dns.DNSResponseCodeType.NotImplemented), minUDPSize, nil
+	}
+
+	questions := dnsQuery.Questions
+	if len(questions) == 0 || (len(questions) > 1 && MultiQuestion == MultiQuestionFormErr) {
+		log.Println("Rejecting query with QDCOUNT:", dnsQuery.Header.QDCOUNT)
+		return errorResponse(dnsQuery, dns.DNSResponseCodeType.FormatError), minUDPSize, nil
+	}
+	if MultiQuestion == MultiQuestionFirst {
+		questions = questions[:1]
+	}
+
+	for _, question := range questions {
+		if question.Class != dns.ClassType.IN || question.Type == dns.RType.AXFR || question.Type == dns.RType.IXFR {
+			log.Println("Refusing query:", question)
+			return errorResponse(dnsQuery, dns.DNSResponseCodeType.Refused), minUDPSize, nil
+		}
+		if err := question.Domain.ValidateALabels(); err != nil {
+			log.Println("Rejecting query:", err)
+			return errorResponse(dnsQuery, dns.DNSResponseCodeType.FormatError), minUDPSize, nil
+		}
 	}
 
 	responseHeader := dns.DNSHeader{
@@ -51,51 +75,149 @@ func handlePacket(queryBuffer []byte) (dns.DNSPacket, error) {
 		AD:      0,
 		CD:      0,
 		RCODE:   dns.DNSResponseCodeType.NoError,
-		QDCOUNT: dnsQuery.Header.QDCOUNT,
+		QDCOUNT: uint16(len(questions)),
 		ANCOUNT: 0,
 		NSCOUNT: 0,
 		ARCOUNT: 0,
 	}
 
-	responsePacket := dns.DNSPacket{Header: responseHeader, Questions: dnsQuery.Questions}
+	responsePacket := dns.DNSPacket{Header: responseHeader, Questions: questions}
 
-	answers, err := resolve(getRandomDNSServer(RootServers), dnsQuery.Questions[0].Domain, dnsQuery.Questions[0].Type, 0)
+	clientOPT, err := findOPT(dnsQuery)
 	if err != nil {
-		log.Println("Failed to resolve DNS query:", err)
-		if rescodeErr, ok := err.(RESCODEError); ok {
-			responsePacket.Header.RCODE = rescodeErr.Code
-		} else {
-			responsePacket.Header.RCODE = dns.DNSResponseCodeType.ServerFailure
+		log.Println("Rejecting query:", err)
+		responsePacket.Header.RCODE = dns.DNSResponseCodeType.FormatError
+		return responsePacket, minUDPSize, nil
+	}
+
+	maxSize := clientUDPSize(clientOPT)
+	var serverOPT *dns.OPTRecord
+	if clientOPT != nil {
+		serverOPT = &dns.OPTRecord{Name: ".", UDPSize: ServerUDPSize, Version: ednsVersion}
+		if clientOPT.Version > ednsVersion {
+			responsePacket.Header.RCODE = dns.DNSResponseCodeType.BadVersion
+			responsePacket.Additional = []dns.DNSRecord{*serverOPT}
+			responsePacket.Header.ARCOUNT = 1
+			return responsePacket, maxSize, nil
 		}
-	} else {
-		responsePacket.Answers = answers
-		responsePacket.Header.ANCOUNT = uint16(len(answers))
 	}
 
-	for _, additionalRecord := range dnsQuery.Additional {
-		if record, ok := additionalRecord.(dns.OPTRecord); ok {
-			responsePacket.Additional = append(responsePacket.Additional, record)
-		}
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeBudget)
+	defer cancel()
+
+	for _, question := range questions {
+		answers, err := lookup(ctx, question.Domain, question.Type)
+		addAnswer(&responsePacket, serverOPT, answers, err)
+	}
+	responsePacket.Header.ANCOUNT = uint16(len(responsePacket.Answers))
+	responsePacket.Header.NSCOUNT = uint16(len(responsePacket.Authoratives))
+
+	if serverOPT != nil {
+		responsePacket.Additional = append(responsePacket.Additional, *serverOPT)
 	}
 	responsePacket.Header.ARCOUNT = uint16(len(responsePacket.Additional))
 
-	return responsePacket, nil
+	return responsePacket, maxSize, nil
+}
+
+// errorResponse builds a minimal response carrying rcode for queries that are
+// not answered at all. The question section is echoed when it was parsed in
+// full, and so is EDNS when the query used it correctly.
+func errorResponse(dnsQuery *dns.DNSPacket, rcode dns.DNSResponseCode) dns.DNSPacket {
+	responsePacket := dns.DNSPacket{
+		Header: dns.DNSHeader{
+			ID:     dnsQuery.Header.ID,
+			QR:     1, // Response
+			OPCODE: dnsQuery.Header.OPCODE,
+			RD:     dnsQuery.Header.RD,
+			RA:     1, // Recursion available
+			RCODE:  rcode,
+		},
+	}
+
+	if len(dnsQuery.Questions) == int(dnsQuery.Header.QDCOUNT) {
+		responsePacket.Questions = dnsQuery.Questions
+		responsePacket.Header.QDCOUNT = dnsQuery.Header.QDCOUNT
+	}
+
+	if clientOPT, err := findOPT(dnsQuery); err == nil && clientOPT != nil && clientOPT.Version <= ednsVersion {
+		responsePacket.Additional = []dns.DNSRecord{dns.OPTRecord{Name: ".", UDPSize: ServerUDPSize, Version: ednsVersion}}
+		responsePacket.Header.ARCOUNT = 1
+	}
+
+	return responsePacket
+}
+
+// lookup answers a question, honouring any forward or stub zone that covers
+// the domain before falling back to iterating from the root servers. Reverse
+// lookups need nothing special: in-addr.arpa and ip6.arpa are delegated like
+// any other zone, and partial names such as RFC 2317 classless delegations
+// must resolve too, so PTR queries take the same path.
+func lookup(ctx context.Context, domain dns.Name, recordType dns.RecordType) ([]dns.DNSRecord, error) {
+	if route, ok := findZoneRoute(domain); ok {
+		switch route.Mode {
+		case RouteForward:
+			return forward(ctx, route, domain, recordType)
+		case RouteStub:
+			return resolve(ctx, map[dns.Name][]net.IP{route.Zone: route.Servers}, route.Zone, domain, recordType, 0)
+		}
+	}
+	return resolve(ctx, rootServers(), dns.RootName, domain, recordType, 0)
+}
+
+// buildQuery creates a single question query packet with a random ID.
+func buildQuery(domain dns.Name, recordType dns.RecordType, recursionDesired uint8) dns.DNSPacket {
+	return dns.DNSPacket{
+		Header: dns.DNSHeader{
+			ID:      uint16(rand.Intn(65536)), // Random ID for the DNS query
+			QR:      0,                        // Query
+			OPCODE:  0,                        // Standard query,
+			RD:      recursionDesired,
+			QDCOUNT: 1,
+		},
+		Questions: []dns.DNSQuestion{
+			{
+				Domain: domain,
+				Type:   recordType,
+				Class:  dns.ClassType.IN, // Internet class
+			},
+		},
+		Additional: []dns.DNSRecord{},
+	}
+}
+
+// rcodeRecords returns the SOA records of a negative response so that the
+// client can cache the NXDOMAIN.
+func rcodeRecords(responsePacket *dns.DNSPacket) []dns.DNSRecord {
+	var dnsRecord []dns.DNSRecord = nil
+	if responsePacket.Header.RCODE == dns.DNSResponseCodeType.NameError {
+		for _, authorative := range responsePacket.Authoratives {
+			if authorative.Preamble().Type == dns.RType.SOA {
+				dnsRecord = append(dnsRecord, authorative)
+			}
+		}
+	}
+	return dnsRecord
 }
 
 // queryOverTCP is used by the query function to handle truncated DNS responses over TCP.
-func queryOverTCP(dnsServer net.IP, query dns.DNSPacket) ([]byte, error) {
+func queryOverTCP(dnsServer net.IP, query dns.DNSPacket, timeout time.Duration) ([]byte, error) {
 	log.Printf("Dialing DNS server over TCP: %s", dnsServer.String())
 
 	dnsServerAddr := &net.TCPAddr{
 		IP:   dnsServer,
 		Port: 53,
 	}
-	conn, err := net.DialTCP("tcp", nil, dnsServerAddr)
+	conn, err := net.DialTimeout("tcp", dnsServerAddr.String(), timeout)
 	if err != nil {
 		return nil, err
 	}
 	defer conn.Close()
 
+	if err = conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+
 	queryBuffer, err := query.ToBytes()
 	if err != nil {
 		return nil, err
@@ -126,7 +248,10 @@ func queryOverTCP(dnsServer net.IP, query dns.DNSPacket) ([]byte, error) {
 	return response, nil
 }
 
-func query(dnsServerAddr net.IP, query dns.DNSPacket) (*dns.DNSPacket, error) {
+// query sends query to dnsServerAddr over UDP and waits for the matching
+// response until timeout. With exactCase set, responses that do not spell the
+// question name exactly as asked are discarded like spoofed ones.
+func query(dnsServerAddr net.IP, query dns.DNSPacket, timeout time.Duration, exactCase bool) (*dns.DNSPacket, error) {
 
 	// This function queries the DNS server using UDP.
 	// In case if required it used TCP to query the DNS server.
@@ -153,7 +278,7 @@ func query(dnsServerAddr net.IP, query dns.DNSPacket) (*dns.DNSPacket, error) {
 
 	defer forwardConn.Close()
 
-	buf := make([]byte, 4096) // 4KB buffer
+	buf := make([]byte, max(4096, int(UpstreamUDPSize))) // At least 4KB, more if we advertise a larger EDNS buffer
 	serializedQuery, err := query.ToBytes()
 	if err != nil {
 		return nil, err
@@ -164,20 +289,57 @@ func query(dnsServerAddr net.IP, query dns.DNSPacket) (*dns.DNSPacket, error) {
 		return nil, err
 	}
 
-	if err = forwardConn.SetDeadline(time.Now().Add(10 * time.Second)); err != nil {
+	if err = forwardConn.SetDeadline(time.Now().Add(timeout)); err != nil {
 		log.Println("Failed to set deadline on forward connection:", err)
 	}
 
-	n2, _, err := forwardConn.ReadFromUDP(buf)
-	if err != nil {
-		log.Println("Failed to read from forward connection:", err)
-		return nil, err
-	}
+	// Anyone can send us a datagram, so keep reading until the real answer
+	// arrives or the deadline passes instead of trusting the first one.
+	var parsedResponse *dns.DNSPacket
+	miscased := false
+	for {
+		n2, from, err := forwardConn.ReadFromUDP(buf)
+		if err != nil {
+			log.Println("Failed to read from forward connection:", err)
+			if miscased {
+				// The server answered, just never in the case we asked.
+				return nil, fmt.Errorf("%w: %w", errCaseMismatch, err)
+			}
+			return nil, err
+		}
+		if !from.IP.Equal(dnsServerAddr) || from.Port != dnsServer.Port {
+			discardResponse(dnsServerAddr, MismatchSource, fmt.Errorf("datagram from %s", from))
+			continue
+		}
 
-	parsedResponse, err := dns.ParseDNSPacket(buf[:n2], n2)
-	if err != nil {
-		if err.Error() == "Truncated DNS packet" {
-			newPacketBytes, err := queryOverTCP(dnsServerAddr, query)
+		parsedResponse, err = dns.ParseDNSPacket(buf[:n2], n2)
+		if parsedResponse == nil {
+			discardResponse(dnsServerAddr, MismatchMalformed, err)
+			continue
+		}
+		if parsedResponse.Header.ID != query.Header.ID {
+			discardResponse(dnsServerAddr, MismatchID, fmt.Errorf("ID %d does not match query ID %d", parsedResponse.Header.ID, query.Header.ID))
+			continue
+		}
+		if err != nil && !errors.Is(err, dns.ErrTruncated) {
+			// A spoofer that guessed the ID must not be able to end the
+			// exchange with garbage, so keep waiting for the real answer.
+			discardResponse(dnsServerAddr, MismatchMalformed, err)
+			continue
+		}
+		if reason, mismatch := responseMismatch(query, parsedResponse); mismatch != nil {
+			discardResponse(dnsServerAddr, reason, mismatch)
+			continue
+		}
+		if exactCase && !caseMatches(query, parsedResponse) {
+			discardResponse(dnsServerAddr, MismatchCase, fmt.Errorf("question name %s not echoed as %s", parsedResponse.Questions[0].Domain, query.Questions[0].Domain))
+			miscased = true
+			continue
+		}
+
+		if errors.Is(err, dns.ErrTruncated) {
+			log.Printf("Response from %s truncated after %d answers, retrying over TCP", dnsServerAddr, len(parsedResponse.Answers))
+			newPacketBytes, err := queryOverTCP(dnsServerAddr, query, timeout)
 			if err != nil {
 				log.Println("Error querying DNS server over TCP:", err)
 				return nil, err
@@ -187,150 +349,252 @@ func query(dnsServerAddr net.IP, query dns.DNSPacket) (*dns.DNSPacket, error) {
 				log.Println("Error parsing DNS packet:", err)
 				return nil, err
 			}
-		} else {
-			log.Println("Failed to parse DNS response:", err)
-			return nil, err
+			if _, mismatch := responseMismatch(query, parsedResponse); mismatch != nil {
+				return nil, fmt.Errorf("TCP response from %s does not match the query: %v", dnsServerAddr, mismatch)
+			}
+			if exactCase && !caseMatches(query, parsedResponse) {
+				return nil, fmt.Errorf("%w: TCP response from %s", errCaseMismatch, dnsServerAddr)
+			}
 		}
+		break
 	}
 
 	return parsedResponse, nil
 }
 
-func getRandomDNSServer(servers map[string][]net.IP) net.IP {
-	keys := make([]string, 0, len(servers))
-	for k := range servers {
-		keys = append(keys, k)
-	}
+// discardResponse counts and logs an upstream response that does not belong
+// to the query we are waiting for.
+func discardResponse(dnsServer net.IP, reason MismatchReason, err error) {
+	total := responseMismatches.add(reason)
+	log.Printf("Discarding response while waiting for %s (%s mismatch, %d so far): %v", dnsServer, reason, total, err)
+}
 
-	serverDomain := keys[rand.Intn(len(keys))]
-	server := servers[serverDomain]
+// queryServers sends queryPacket to the fastest known server in addresses and moves
+// on to the next best one when a server fails to answer or answers with
+// SERVFAIL or REFUSED. The RTT tracker is updated with every outcome. Every
+// attempt gets a short timeout and the whole exchange stops once ctx is done.
+// With randomCase set the question name is sent with 0x20 case randomisation.
+func queryServers(ctx context.Context, addresses []net.IP, queryPacket dns.DNSPacket, randomCase bool) (*dns.DNSPacket, error) {
+	if len(addresses) == 0 {
+		return nil, serverFailure(dns.EDECodeType.NoReachableAuthority, "no nameserver addresses to query")
+	}
+
+	var lastResponse *dns.DNSPacket
+	var lastErr error
+	for _, dnsServer := range serverRTTs.order(addresses) {
+		if ctx.Err() != nil {
+			lastErr = serverFailure(dns.EDECodeType.NoReachableAuthority, "query time budget exhausted")
+			break
+		}
 
-	if len(server) == 0 {
-		packets, err := resolve(getRandomDNSServer(RootServers), serverDomain, dns.RType.A, 0)
-		if err != nil {
-			log.Println("Failed to resolve nameserver domain:", err)
-			return nil
+		timeout := serverRTTs.attemptTimeout(dnsServer)
+		if budget, ok := ctx.Deadline(); ok {
+			timeout = min(timeout, time.Until(budget))
+		}
+		start := time.Now()
+		var responsePacket *dns.DNSPacket
+		var err error
+		if randomCase {
+			responsePacket, err = queryWithRandomCase(dnsServer, queryPacket, timeout)
+		} else {
+			responsePacket, err = queryWithEDNS(dnsServer, queryPacket, timeout, false)
 		}
-		for _, record := range packets {
-			if aRecord, ok := record.(dns.ADNSRecord); ok {
-				server = append(server, aRecord.IP)
-			} else if aaaaRecord, ok := record.(dns.AAAARecord); ok {
-				server = append(server, aaaaRecord.IP)
+		elapsed := time.Since(start)
+		if err != nil {
+			log.Printf("Query to %s failed: %v", dnsServer, err)
+			serverRTTs.penalise(dnsServer, elapsed)
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				lastErr = serverFailure(dns.EDECodeType.NoReachableAuthority, "%s timed out", dnsServer)
+			} else {
+				lastErr = serverFailure(dns.EDECodeType.NetworkError, "%s: %v", dnsServer, err)
 			}
+			continue
 		}
+
+		rcode := responsePacket.Header.RCODE
+		if rcode == dns.DNSResponseCodeType.ServerFailure || rcode == dns.DNSResponseCodeType.Refused {
+			log.Printf("Server %s answered %s, trying the next one", dnsServer, rcode)
+			serverRTTs.penalise(dnsServer, elapsed)
+			lastResponse = responsePacket
+			continue
+		}
+
+		serverRTTs.record(dnsServer, elapsed)
+		return responsePacket, nil
 	}
 
-	// Prefer IPv4 addresses
-	ipv4s := []net.IP{}
-	for _, ip := range server {
-		if ip.To4() != nil {
-			ipv4s = append(ipv4s, ip)
+	if lastResponse != nil {
+		return lastResponse, nil
+	}
+	return nil, lastErr
+}
+
+// referral extracts the delegation from a response sent by the nameservers
+// of zone. Only NS records for a zone below zone that contains domain are
+// accepted, all for the same zone, which is returned with the nameservers
+// keyed by canonical host name. Glue is only taken for hosts inside zone,
+// the bailiwick of the servers that sent it, so hosts elsewhere are returned
+// without addresses and get resolved from the root.
+func referral(responsePacket *dns.DNSPacket, zone dns.Name, domain dns.Name) (dns.Name, map[dns.Name][]net.IP) {
+	var nextZone dns.Name
+	nsServers := make(map[dns.Name][]net.IP)
+
+	for _, authorative := range responsePacket.Authoratives {
+		record, ok := authorative.(dns.NSDNSRecord)
+		if !ok {
+			continue
 		}
+		if !record.Name.IsSubdomainOf(zone) || record.Name.Equal(zone) || !domain.IsSubdomainOf(record.Name) ||
+			(len(nsServers) > 0 && !record.Name.Equal(nextZone)) {
+			log.Printf("Ignoring out-of-zone NS record %s -> %s from the servers of %s", record.Name, record.Host, zone)
+			continue
+		}
+		nextZone = record.Name
+		nsServers[record.Host.Canonical()] = []net.IP{}
 	}
 
-	if len(ipv4s) > 0 {
-		k := rand.Intn(len(ipv4s))
-		return ipv4s[k]
+	for _, additionalRecord := range responsePacket.Additional {
+		var host dns.Name
+		var ip net.IP
+		switch record := additionalRecord.(type) {
+		case dns.ADNSRecord:
+			host, ip = record.Name.Canonical(), record.IP
+		case dns.AAAARecord:
+			host, ip = record.Name.Canonical(), record.IP
+		default:
+			continue
+		}
+		ips, exists := nsServers[host]
+		if !exists {
+			continue
+		}
+		if !host.IsSubdomainOf(zone) {
+			log.Printf("Ignoring out-of-bailiwick glue %s -> %s from the servers of %s", host, ip, zone)
+			continue
+		}
+		nsServers[host] = append(ips, ip)
 	}
 
-	if len(server) == 0 {
-		log.Println("No valid IP addresses found for nameserver domain:", serverDomain)
-		return nil
+	return nextZone, nsServers
+}
+
+// inBailiwick drops the records that the nameservers of zone have no
+// authority over.
+func inBailiwick(records []dns.DNSRecord, zone dns.Name) []dns.DNSRecord {
+	var filtered []dns.DNSRecord
+	for _, record := range records {
+		if !record.Preamble().Name.IsSubdomainOf(zone) {
+			log.Printf("Ignoring out-of-bailiwick record %s %s from the servers of %s", record.Preamble().Name, record.Preamble().Type, zone)
+			continue
+		}
+		filtered = append(filtered, record)
 	}
+	return filtered
+}
 
-	// Fallback to IPv6 if no IPv4 is available
-	k := rand.Intn(len(server))
-	return server[k]
+// noData reports whether a NOERROR response from the nameservers of zone
+// without answers or a referral is a NODATA answer: the name exists but has
+// no records of the type asked. That is the case when its authority section
+// holds the SOA of zone or, as some servers send, the NS set of zone itself.
+// NS records for any other zone make it an invalid referral.
+func noData(responsePacket *dns.DNSPacket, zone dns.Name, domain dns.Name) (bool, error) {
+	invalidReferral := false
+	for _, authorative := range inBailiwick(responsePacket.Authoratives, zone) {
+		switch authorative.Preamble().Type {
+		case dns.RType.SOA:
+			return true, nil
+		case dns.RType.NS:
+			if authorative.Preamble().Name.Equal(zone) {
+				return true, nil
+			}
+			invalidReferral = true
+		}
+	}
+	if invalidReferral {
+		return false, serverFailure(dns.EDECodeType.NoReachableAuthority, "the nameservers of %s sent an invalid referral for %s", zone, domain)
+	}
+	return false, nil
 }
 
-func resolve(dnsServer net.IP, domain string, recordType dns.RecordType, depth uint) ([]dns.DNSRecord, error) {
+// resolve iteratively looks up domain starting at nsServers, the nameservers
+// of zone. With QNAME minimisation enabled, only one more label than zone is
+// revealed to them until they hand out a referral.
+func resolve(ctx context.Context, nsServers map[dns.Name][]net.IP, zone dns.Name, domain dns.Name, recordType dns.RecordType, depth uint) ([]dns.DNSRecord, error) {
 	if depth >= 10 {
-		return nil, errors.New("resolution depth limit exceeded")
-	}
-	dnsQueryPacket := dns.DNSPacket{
-		Header: dns.DNSHeader{
-			ID:      uint16(rand.Intn(65536)), // Random ID for the DNS query
-			QR:      0,                        // Query
-			OPCODE:  0,                        // Standard query,
-			RD:      1,                        // Recursion Desired
-			QDCOUNT: 1,
-		},
-		Questions: []dns.DNSQuestion{
-			{
-				Domain: domain,
-				Type:   recordType,
-				Class:  dns.ClassType.IN, // Internet class
-			},
-		},
-		Additional: []dns.DNSRecord{},
+		return nil, serverFailure(dns.EDECodeType.Other, "resolution depth limit exceeded")
 	}
 
-	responsePacket, err := query(dnsServer, dnsQueryPacket)
-	if err != nil {
-		return nil, err
+	qname, qtype := domain, recordType
+	minimiseCount := 0
+	if QnameMinimisation != QnameMinimisationOff && domain.IsSubdomainOf(zone) {
+		qname, qtype = minimisedQuestion(zone, domain, recordType, minimiseCount)
 	}
 
-	if responsePacket.Header.RCODE != dns.DNSResponseCodeType.NoError {
-		err := RESCODEError{responsePacket.Header.RCODE}
-		var dnsRecord []dns.DNSRecord = nil
-		if responsePacket.Header.RCODE == dns.DNSResponseCodeType.NameError {
-			for _, authorative := range responsePacket.Authoratives {
-				if authorative.Preamble().Type == dns.RType.SOA {
-					dnsRecord = append(dnsRecord, authorative)
-				}
-			}
-		}
-		return dnsRecord, err
+	addresses := nameserverAddresses(ctx, zone, nsServers)
+	if len(addresses) == 0 {
+		return nil, serverFailure(dns.EDECodeType.NoReachableAuthority, "no addresses for the nameservers of %s", zone)
 	}
 
-	for _, answer := range responsePacket.Answers {
-		if answer.Preamble().Type == recordType && answer.Preamble().Name == domain {
-			return responsePacket.Answers, nil
+	var responsePacket *dns.DNSPacket
+	for {
+		var err error
+		responsePacket, err = queryServers(ctx, addresses, buildQuery(qname, qtype, 1), CaseRandomization)
+		if err != nil {
+			return nil, err
+		}
+		if qname.Equal(domain) {
+			break
 		}
-	}
 
-	for _, answer := range responsePacket.Answers {
-		if answer.Preamble().Type == dns.RType.CNAME {
-			record, ok := answer.(dns.CNAMERecord)
-			if !ok {
-				panic("Preamble type is CNAME but can't be made into CNAME DNS record")
-			}
-			cnameTarget := record.CanonicalName
-			resolved, err := resolve(dnsServer, cnameTarget, recordType, depth+1)
-			if err != nil {
-				return nil, err
+		rcode := responsePacket.Header.RCODE
+		if rcode == dns.DNSResponseCodeType.NoError {
+			nextZone, nsServers := referral(responsePacket, zone, domain)
+			if len(responsePacket.Answers) == 0 && len(nsServers) > 0 && !nextZone.Equal(zone) {
+				// Found the next zone cut, follow the referral below.
+				break
 			}
-			return append([]dns.DNSRecord{answer}, resolved...), nil
+			// qname exists but is not delegated, so reveal another label.
+			minimiseCount++
+			qname, qtype = minimisedQuestion(qname, domain, recordType, minimiseCount)
+			continue
 		}
-	}
 
-	nsServers := make(map[string][]net.IP)
+		if QnameMinimisation == QnameMinimisationStrict {
+			return rcodeRecords(responsePacket), upstreamError(responsePacket, zone)
+		}
+		log.Printf("Minimised query for %s failed with %s, retrying with the full name", qname, rcode)
+		qname, qtype = domain, recordType
+	}
 
-	for _, nsRecord := range responsePacket.Authoratives {
-		record := nsRecord.(dns.NSDNSRecord)
-		nsServers[record.Host] = []net.IP{}
+	if responsePacket.Header.RCODE != dns.DNSResponseCodeType.NoError {
+		return rcodeRecords(responsePacket), upstreamError(responsePacket, zone)
 	}
 
-	for _, additionalRecord := range responsePacket.Additional {
-		switch record := additionalRecord.(type) {
-		case dns.ADNSRecord:
-			if ips, exists := nsServers[record.Name]; exists {
-				nsServers[record.Name] = append(ips, record.IP)
-			}
-		case dns.AAAARecord:
-			if ips, exists := nsServers[record.Name]; exists {
-				nsServers[record.Name] = append(ips, record.IP)
-			}
-		}
+	records, chain, next, err := followAliases(inBailiwick(responsePacket.Answers, zone), domain, recordType, aliasChain(ctx))
+	if err != nil {
+		return records, err
+	}
+	if next != "" {
+		// The alias chain leaves the response, continue from its last name.
+		// The aliases are kept when the target does not resolve, so that the
+		// client sees where an NXDOMAIN comes from.
+		resolved, err := resolveAlias(ctx, nsServers, zone, next, recordType, chain, depth)
+		return append(records, resolved...), err
+	}
+	if len(records) > 0 {
+		return records, nil
 	}
 
-	if len(nsServers) == 0 {
+	nextZone, nextServers := referral(responsePacket, zone, domain)
+
+	if len(nextServers) == 0 {
+		isNoData, err := noData(responsePacket, zone, domain)
+		if isNoData || err != nil {
+			return nil, err
+		}
 		log.Println("No nameservers found in response, using root servers")
-		nsServers = RootServers
-	}
-	nextDNSServer := getRandomDNSServer(nsServers)
-	if nextDNSServer == nil {
-		return nil, errors.New("no valid nameservers found for domain: " + domain)
+		nextZone, nextServers = dns.RootName, rootServers()
 	}
-	return resolve(nextDNSServer, domain, recordType, depth+1)
+	return resolve(ctx, nextServers, nextZone, domain, recordType, depth+1)
 }
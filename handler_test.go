@@ -0,0 +1,390 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/rounakkumarsingh/dns-server/dns"
+)
+
+func TestAppendNegativeAnswer(t *testing.T) {
+	soa := dns.SOARecord{DNSRecordPreamble: preamble("example.net.", dns.RType.SOA), MName: "ns.example.net.", RName: "hostmaster.example.net."}
+	var responsePacket dns.DNSPacket
+	appendNegativeAnswer(&responsePacket, []dns.DNSRecord{cname("www.example.com.", "missing.example.net."), soa})
+
+	if got, want := recordNames(responsePacket.Answers), []string{"CNAME www.example.com."}; !slices.Equal(got, want) {
+		t.Errorf("answers = %v, want %v", got, want)
+	}
+	if got, want := recordNames(responsePacket.Authoratives), []string{"SOA example.net."}; !slices.Equal(got, want) {
+		t.Errorf("authority = %v, want %v", got, want)
+	}
+}
+
+func nsRecord(zone, host dns.Name) dns.NSDNSRecord {
+	return dns.NSDNSRecord{DNSRecordPreamble: preamble(zone, dns.RType.NS), Host: host}
+}
+
+func TestReferral(t *testing.T) {
+	tests := []struct {
+		name       string
+		zone       dns.Name
+		domain     dns.Name
+		authority  []dns.DNSRecord
+		additional []dns.DNSRecord
+		wantZone   dns.Name
+		wantHosts  map[dns.Name][]string
+	}{
+		{
+			name:       "delegation with glue",
+			zone:       "com.",
+			domain:     "www.example.com.",
+			authority:  []dns.DNSRecord{nsRecord("example.com.", "NS1.example.com."), nsRecord("example.com.", "ns.example.net.")},
+			additional: []dns.DNSRecord{aRecord("ns1.example.com.", "192.0.2.1"), aRecord("ns.example.net.", "192.0.2.2")},
+			wantZone:   "example.com.",
+			// Glue for example.net. is outside the bailiwick of com.
+			wantHosts: map[dns.Name][]string{"ns1.example.com.": {"192.0.2.1"}, "ns.example.net.": nil},
+		},
+		{
+			name:      "out-of-zone NS records dropped",
+			zone:      "example.com.",
+			domain:    "www.sub.example.com.",
+			authority: []dns.DNSRecord{nsRecord("com.", "evil.example.org."), nsRecord("example.org.", "evil.example.org."), nsRecord("example.com.", "evil.example.org."), nsRecord("sub.example.com.", "ns.sub.example.com.")},
+			wantZone:  "sub.example.com.",
+			wantHosts: map[dns.Name][]string{"ns.sub.example.com.": nil},
+		},
+		{
+			name:      "NS records for a zone not containing the name dropped",
+			zone:      "com.",
+			domain:    "www.example.com.",
+			authority: []dns.DNSRecord{nsRecord("other.com.", "ns.other.com."), nsRecord("example.com.", "ns.example.com."), nsRecord("sub.www.example.com.", "ns.example.com.")},
+			wantZone:  "example.com.",
+			wantHosts: map[dns.Name][]string{"ns.example.com.": nil},
+		},
+		{
+			name:       "sibling glue dropped",
+			zone:       "example.com.",
+			domain:     "www.sub.example.com.",
+			authority:  []dns.DNSRecord{nsRecord("sub.example.com.", "ns.sub.example.com.")},
+			additional: []dns.DNSRecord{aRecord("ns.sub.example.com.", "192.0.2.3"), aRecord("ns.other.example.com.", "192.0.2.4"), aRecord("www.sub.example.com.", "192.0.2.5")},
+			wantZone:   "sub.example.com.",
+			wantHosts:  map[dns.Name][]string{"ns.sub.example.com.": {"192.0.2.3"}},
+		},
+		{
+			name:      "no delegation",
+			zone:      "example.com.",
+			domain:    "www.example.com.",
+			authority: []dns.DNSRecord{nsRecord("example.com.", "ns.example.com.")},
+			wantHosts: map[dns.Name][]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			responsePacket := &dns.DNSPacket{Authoratives: tt.authority, Additional: tt.additional}
+			zone, servers := referral(responsePacket, tt.zone, tt.domain)
+			if zone != tt.wantZone {
+				t.Errorf("zone = %q, want %q", zone, tt.wantZone)
+			}
+			got := make(map[dns.Name][]string)
+			for host, ips := range servers {
+				got[host] = nil
+				for _, ip := range ips {
+					got[host] = append(got[host], ip.String())
+				}
+			}
+			if len(got) != len(tt.wantHosts) {
+				t.Fatalf("servers = %v, want %v", got, tt.wantHosts)
+			}
+			for host, ips := range tt.wantHosts {
+				if gotIPs, ok := got[host]; !ok || !slices.Equal(gotIPs, ips) {
+					t.Errorf("servers[%s] = %v, want %v", host, gotIPs, ips)
+				}
+			}
+		})
+	}
+}
+
+func TestInBailiwick(t *testing.T) {
+	records := []dns.DNSRecord{
+		aRecord("www.example.com.", "192.0.2.1"),
+		aRecord("EXAMPLE.com.", "192.0.2.2"),
+		aRecord("www.example.net.", "192.0.2.3"),
+		cname("alias.example.com.", "www.example.org."),
+		aRecord("www.example.org.", "192.0.2.4"),
+		aRecord("com.", "192.0.2.5"),
+	}
+	want := []string{"A www.example.com.", "A example.com.", "CNAME alias.example.com."}
+	if got := recordNames(inBailiwick(records, "example.com.")); !slices.Equal(got, want) {
+		t.Errorf("inBailiwick(example.com.) = %v, want %v", got, want)
+	}
+	if got := inBailiwick(records, "."); len(got) != len(records) {
+		t.Errorf("inBailiwick(.) kept %d of %d records", len(got), len(records))
+	}
+}
+
+func TestNoData(t *testing.T) {
+	soa := dns.SOARecord{DNSRecordPreamble: preamble("example.com.", dns.RType.SOA), MName: "ns.example.com.", RName: "hostmaster.example.com."}
+	tests := []struct {
+		name      string
+		authority []dns.DNSRecord
+		noData    bool
+		wantErr   bool
+	}{
+		{"SOA", []dns.DNSRecord{soa}, true, false},
+		{"apex NS set", []dns.DNSRecord{nsRecord("Example.com.", "ns1.example.com."), nsRecord("example.com.", "ns2.example.com.")}, true, false},
+		{"NS for another zone", []dns.DNSRecord{nsRecord("other.example.com.", "ns.example.com.")}, false, true},
+		{"NS for another zone and SOA", []dns.DNSRecord{nsRecord("other.example.com.", "ns.example.com."), soa}, true, false},
+		{"out-of-bailiwick SOA", []dns.DNSRecord{dns.SOARecord{DNSRecordPreamble: preamble("example.net.", dns.RType.SOA)}}, false, false},
+		{"empty", nil, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isNoData, err := noData(&dns.DNSPacket{Authoratives: tt.authority}, "example.com.", "www.example.com.")
+			if isNoData != tt.noData || (err != nil) != tt.wantErr {
+				t.Errorf("noData() = %v, %v, want %v (error %v)", isNoData, err, tt.noData, tt.wantErr)
+			}
+		})
+	}
+}
+
+// rawQuery serializes a query for questions, letting edit change the packet
+// before it is encoded.
+func rawQuery(t *testing.T, questions []dns.DNSQuestion, edit func(*dns.DNSPacket)) []byte {
+	t.Helper()
+	packet := dns.DNSPacket{
+		Header:    dns.DNSHeader{ID: 0xbeef, RD: 1, QDCOUNT: uint16(len(questions))},
+		Questions: questions,
+	}
+	if edit != nil {
+		edit(&packet)
+	}
+	buf, err := packet.ToBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf
+}
+
+func TestHandlePacketRejects(t *testing.T) {
+	defer func(policy MultiQuestionPolicy) { MultiQuestion = policy }(MultiQuestion)
+	MultiQuestion = MultiQuestionFormErr
+
+	question := func(domain dns.Name, recordType dns.RecordType, class dns.Class) dns.DNSQuestion {
+		return dns.DNSQuestion{Domain: domain, Type: recordType, Class: class}
+	}
+	www := question("www.example.com.", dns.RType.A, dns.ClassType.IN)
+
+	tests := []struct {
+		name         string
+		query        []byte
+		wantCode     dns.DNSResponseCode
+		wantQuestion bool
+	}{
+		{
+			name:         "unsupported OPCODE",
+			query:        rawQuery(t, []dns.DNSQuestion{www}, func(p *dns.DNSPacket) { p.Header.OPCODE = 2 }),
+			wantCode:     dns.DNSResponseCodeType.NotImplemented,
+			wantQuestion: true,
+		},
+		{
+			name:     "no question",
+			query:    rawQuery(t, nil, nil),
+			wantCode: dns.DNSResponseCodeType.FormatError,
+		},
+		{
+			name:         "several questions",
+			query:        rawQuery(t, []dns.DNSQuestion{www, question("mail.example.com.", dns.RType.MX, dns.ClassType.IN)}, nil),
+			wantCode:     dns.DNSResponseCodeType.FormatError,
+			wantQuestion: true,
+		},
+		{
+			name: "truncated question",
+			query: func() []byte {
+				buf := rawQuery(t, []dns.DNSQuestion{www}, nil)
+				return buf[:len(buf)-2]
+			}(),
+			wantCode: dns.DNSResponseCodeType.FormatError,
+		},
+		{
+			name: "fewer questions than QDCOUNT",
+			query: func() []byte {
+				buf := rawQuery(t, []dns.DNSQuestion{www}, nil)
+				buf[5] = 2
+				return buf
+			}(),
+			wantCode: dns.DNSResponseCodeType.FormatError,
+		},
+		{
+			name:         "malformed A-label",
+			query:        rawQuery(t, []dns.DNSQuestion{question("xn--zzzzzzzzz.example.", dns.RType.A, dns.ClassType.IN)}, nil),
+			wantCode:     dns.DNSResponseCodeType.FormatError,
+			wantQuestion: true,
+		},
+		{
+			name:         "CHAOS class",
+			query:        rawQuery(t, []dns.DNSQuestion{question("version.bind.", dns.RType.TXT, dns.ClassType.CH)}, nil),
+			wantCode:     dns.DNSResponseCodeType.Refused,
+			wantQuestion: true,
+		},
+		{
+			name:         "zone transfer",
+			query:        rawQuery(t, []dns.DNSQuestion{question("example.com.", dns.RType.AXFR, dns.ClassType.IN)}, nil),
+			wantCode:     dns.DNSResponseCodeType.Refused,
+			wantQuestion: true,
+		},
+		{
+			name:         "incremental zone transfer",
+			query:        rawQuery(t, []dns.DNSQuestion{question("example.com.", dns.RType.IXFR, dns.ClassType.IN)}, nil),
+			wantCode:     dns.DNSResponseCodeType.Refused,
+			wantQuestion: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			responsePacket, maxSize, err := handlePacket(tt.query)
+			if err != nil {
+				t.Fatalf("handlePacket() error = %v", err)
+			}
+			if maxSize != minUDPSize {
+				t.Errorf("maxSize = %d, want %d", maxSize, minUDPSize)
+			}
+			header := responsePacket.Header
+			if header.ID != 0xbeef || header.QR != 1 || header.RD != 1 {
+				t.Errorf("header = %s, want ID, QR and RD set", header)
+			}
+			if header.RCODE != tt.wantCode {
+				t.Errorf("RCODE = %s, want %s", header.RCODE, tt.wantCode)
+			}
+			if got := len(responsePacket.Questions) > 0; got != tt.wantQuestion {
+				t.Errorf("question echoed = %v, want %v", got, tt.wantQuestion)
+			}
+			if len(responsePacket.Answers) != 0 || len(responsePacket.Authoratives) != 0 || len(responsePacket.Additional) != 0 {
+				t.Errorf("response has records: %s", responsePacket)
+			}
+			if _, err := responsePacket.ToBytesLimit(maxSize); err != nil {
+				t.Errorf("response cannot be sent: %v", err)
+			}
+		})
+	}
+}
+
+func TestHandlePacketIgnores(t *testing.T) {
+	www := dns.DNSQuestion{Domain: "www.example.com.", Type: dns.RType.A, Class: dns.ClassType.IN}
+	tests := []struct {
+		name  string
+		query []byte
+	}{
+		{"response", rawQuery(t, []dns.DNSQuestion{www}, func(p *dns.DNSPacket) { p.Header.QR = 1 })},
+		{"malformed response", rawQuery(t, []dns.DNSQuestion{www}, func(p *dns.DNSPacket) { p.Header.QR = 1 })[:14]},
+		{"short header", []byte{0xbe, 0xef, 0x01, 0x00, 0x00}},
+		{"empty", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if responsePacket, _, err := handlePacket(tt.query); err == nil {
+				t.Errorf("handlePacket() = %s, want no response", responsePacket)
+			}
+		})
+	}
+}
+
+func TestHandlePacketEDNS(t *testing.T) {
+	www := dns.DNSQuestion{Domain: "www.example.com.", Type: dns.RType.A, Class: dns.ClassType.IN}
+	chaos := dns.DNSQuestion{Domain: "version.bind.", Type: dns.RType.TXT, Class: dns.ClassType.CH}
+	clientOPT := func(version uint8) dns.OPTRecord {
+		opt := dns.OPTRecord{Name: ".", UDPSize: 4096, Version: version, DO: true}
+		if err := opt.SetOption(dns.NSIDOption{}); err != nil {
+			t.Fatal(err)
+		}
+		return opt
+	}
+	withOPT := func(opts ...dns.OPTRecord) func(*dns.DNSPacket) {
+		return func(p *dns.DNSPacket) {
+			for _, opt := range opts {
+				p.Additional = append(p.Additional, opt)
+			}
+			p.Header.ARCOUNT = uint16(len(p.Additional))
+		}
+	}
+
+	tests := []struct {
+		name        string
+		query       []byte
+		wantCode    dns.DNSResponseCode
+		wantOPT     bool
+		wantMaxSize int
+	}{
+		{
+			name:        "unsupported version",
+			query:       rawQuery(t, []dns.DNSQuestion{www}, withOPT(clientOPT(1))),
+			wantCode:    dns.DNSResponseCodeType.BadVersion,
+			wantOPT:     true,
+			wantMaxSize: int(ServerUDPSize),
+		},
+		{
+			name:        "several OPT records",
+			query:       rawQuery(t, []dns.DNSQuestion{www}, withOPT(clientOPT(0), clientOPT(0))),
+			wantCode:    dns.DNSResponseCodeType.FormatError,
+			wantMaxSize: minUDPSize,
+		},
+		{
+			name:        "refused with EDNS",
+			query:       rawQuery(t, []dns.DNSQuestion{chaos}, withOPT(clientOPT(0))),
+			wantCode:    dns.DNSResponseCodeType.Refused,
+			wantOPT:     true,
+			wantMaxSize: minUDPSize,
+		},
+		{
+			name:        "refused with an unsupported version",
+			query:       rawQuery(t, []dns.DNSQuestion{chaos}, withOPT(clientOPT(1))),
+			wantCode:    dns.DNSResponseCodeType.Refused,
+			wantMaxSize: minUDPSize,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			responsePacket, maxSize, err := handlePacket(tt.query)
+			if err != nil {
+				t.Fatalf("handlePacket() error = %v", err)
+			}
+			if maxSize != tt.wantMaxSize {
+				t.Errorf("maxSize = %d, want %d", maxSize, tt.wantMaxSize)
+			}
+
+			buf, err := responsePacket.ToBytesLimit(maxSize)
+			if err != nil {
+				t.Fatalf("response cannot be sent: %v", err)
+			}
+			if got := dns.DNSResponseCode(buf[3] & 0xF); got != tt.wantCode&0xF {
+				t.Errorf("header RCODE on the wire = %d, want %d", got, tt.wantCode&0xF)
+			}
+			sent, err := dns.ParseDNSPacket(buf, len(buf))
+			if err != nil {
+				t.Fatalf("parsing the response: %v", err)
+			}
+			if sent.Header.ID != 0xbeef || sent.Header.RCODE != tt.wantCode {
+				t.Errorf("response ID %#x RCODE %s, want %#x %s", sent.Header.ID, sent.Header.RCODE, 0xbeef, tt.wantCode)
+			}
+
+			serverOPT, err := findOPT(sent)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.wantOPT {
+				if serverOPT != nil {
+					t.Errorf("response has an OPT record: %s", serverOPT)
+				}
+				return
+			}
+			if serverOPT == nil {
+				t.Fatal("response has no OPT record")
+			}
+			// Our own OPT record, nothing copied from the client's.
+			if serverOPT.UDPSize != ServerUDPSize || serverOPT.Version != ednsVersion || serverOPT.DO || len(serverOPT.Options) != 0 {
+				t.Errorf("server OPT = %s, want UDP size %d, version 0 and no options", serverOPT, ServerUDPSize)
+			}
+			if got := serverOPT.ExtRCODE; got != uint8(tt.wantCode>>4) {
+				t.Errorf("OPT extended RCODE = %d, want %d", got, tt.wantCode>>4)
+			}
+		})
+	}
+}
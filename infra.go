@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/rounakkumarsingh/dns-server/dns"
+)
+
+const (
+	// maxParallelNSLookups is the number of glueless nameserver hosts whose
+	// addresses are looked up at the same time.
+	maxParallelNSLookups = 3
+	// maxNSLookupDepth bounds how many glueless delegations may have to be
+	// followed to reach a single nameserver.
+	maxNSLookupDepth = 4
+	// Nameserver addresses are cached for the TTL of their records, within
+	// these bounds.
+	minInfraTTL = 30 * time.Second
+	maxInfraTTL = 24 * time.Hour
+	// maxInfraEntries bounds the number of cached host addresses.
+	maxInfraEntries = 10000
+)
+
+// infraCache remembers the addresses of nameserver hosts that had to be
+// resolved because a referral came without glue. It holds at most
+// maxInfraEntries entries.
+type infraCache struct {
+	mu      sync.Mutex
+	entries map[infraKey]infraEntry
+}
+
+type infraKey struct {
+	host       dns.Name
+	recordType dns.RecordType
+}
+
+type infraEntry struct {
+	addresses []net.IP
+	expires   time.Time
+	lastUsed  time.Time
+}
+
+var nameserverCache = &infraCache{entries: make(map[infraKey]infraEntry)}
+
+// get returns the cached IPv4 and IPv6 addresses of host.
+func (c *infraCache) get(host dns.Name) []net.IP {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	var addresses []net.IP
+	for _, recordType := range []dns.RecordType{dns.RType.A, dns.RType.AAAA} {
+		key := infraKey{host.Canonical(), recordType}
+		entry, ok := c.entries[key]
+		if !ok {
+			continue
+		}
+		if now.After(entry.expires) {
+			delete(c.entries, key)
+			continue
+		}
+		entry.lastUsed = now
+		c.entries[key] = entry
+		addresses = append(addresses, entry.addresses...)
+	}
+	return addresses
+}
+
+// put caches the addresses of type recordType of host for ttl.
+func (c *infraCache) put(host dns.Name, recordType dns.RecordType, addresses []net.IP, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	key := infraKey{host.Canonical(), recordType}
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= maxInfraEntries {
+		c.evict(now)
+	}
+	ttl = min(max(ttl, minInfraTTL), maxInfraTTL)
+	c.entries[key] = infraEntry{addresses: addresses, expires: now.Add(ttl), lastUsed: now}
+}
+
+// evict makes room for a new entry by dropping the expired ones, or the least
+// recently used one if none has expired. The caller must hold c.mu.
+func (c *infraCache) evict(now time.Time) {
+	var oldest infraKey
+	found := false
+	for key, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, key)
+			continue
+		}
+		if !found || entry.lastUsed.Before(c.entries[oldest].lastUsed) {
+			oldest, found = key, true
+		}
+	}
+	if len(c.entries) >= maxInfraEntries {
+		delete(c.entries, oldest)
+	}
+}
+
+// nsLookupKey is the context key of the nameserver hosts whose addresses are
+// being resolved, outermost first.
+type nsLookupKey struct{}
+
+func nsLookupChain(ctx context.Context) []dns.Name {
+	chain, _ := ctx.Value(nsLookupKey{}).([]dns.Name)
+	return chain
+}
+
+// withNSLookup starts the lookup of a nameserver host, which does not belong
+// to the alias chain of the query that needed it.
+func withNSLookup(ctx context.Context, host dns.Name) context.Context {
+	ctx = context.WithValue(ctx, aliasChainKey{}, []dns.Name(nil))
+	return context.WithValue(ctx, nsLookupKey{}, append(slices.Clip(nsLookupChain(ctx)), host))
+}
+
+// nameserverAddresses returns every IPv4 and IPv6 glue address of the
+// nameservers of zone. Without glue the NS host names are resolved from the
+// root, a few at a time, until some of them yield addresses. Hosts inside zone
+// itself cannot be resolved without glue, and neither can hosts that are
+// already being resolved further up, so both are skipped.
+func nameserverAddresses(ctx context.Context, zone dns.Name, servers map[dns.Name][]net.IP) []net.IP {
+	var addresses []net.IP
+	for _, ips := range servers {
+		addresses = append(addresses, ips...)
+	}
+
+	if len(addresses) > 0 {
+		return addresses
+	}
+
+	chain := nsLookupChain(ctx)
+	if len(chain) >= maxNSLookupDepth {
+		log.Printf("Too many glueless delegations resolving %v, giving up on %s", chain, zone)
+		return nil
+	}
+
+	hosts := make([]dns.Name, 0, len(servers))
+	for host := range servers {
+		switch {
+		case host.IsSubdomainOf(zone):
+			log.Printf("Nameserver %s is inside %s but came without glue", host, zone)
+		case slices.ContainsFunc(chain, host.Equal):
+			log.Printf("Nameserver %s depends on itself through %v", host, chain)
+		default:
+			if ips := nameserverCache.get(host); len(ips) > 0 {
+				addresses = append(addresses, ips...)
+			} else {
+				hosts = append(hosts, host)
+			}
+		}
+	}
+	if len(addresses) > 0 {
+		return addresses
+	}
+	rand.Shuffle(len(hosts), func(i, j int) { hosts[i], hosts[j] = hosts[j], hosts[i] })
+
+	for len(hosts) > 0 && ctx.Err() == nil {
+		batch := hosts[:min(maxParallelNSLookups, len(hosts))]
+		hosts = hosts[len(batch):]
+
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		for _, host := range batch {
+			for _, recordType := range []dns.RecordType{dns.RType.A, dns.RType.AAAA} {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					ips := resolveNameserver(withNSLookup(ctx, host), host, recordType)
+					mu.Lock()
+					addresses = append(addresses, ips...)
+					mu.Unlock()
+				}()
+			}
+		}
+		wg.Wait()
+
+		if len(addresses) > 0 {
+			return addresses
+		}
+		log.Printf("No addresses found for nameservers %v of %s", batch, zone)
+	}
+	return nil
+}
+
+// resolveNameserver looks up the addresses of type recordType of a nameserver
+// host and caches them.
+func resolveNameserver(ctx context.Context, host dns.Name, recordType dns.RecordType) []net.IP {
+	records, err := lookup(ctx, host, recordType)
+	if err != nil {
+		log.Printf("Failed to resolve nameserver %s %s: %v", host, recordType, err)
+		return nil
+	}
+
+	var addresses []net.IP
+	ttl := maxInfraTTL
+	for _, record := range records {
+		switch record := record.(type) {
+		case dns.ADNSRecord:
+			addresses = append(addresses, record.IP)
+		case dns.AAAARecord:
+			addresses = append(addresses, record.IP)
+		default:
+			continue
+		}
+		ttl = min(ttl, time.Duration(record.Preamble().TTL)*time.Second)
+	}
+	if len(addresses) > 0 {
+		nameserverCache.put(host, recordType, addresses, ttl)
+	}
+	return addresses
+}
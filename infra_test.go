@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/rounakkumarsingh/dns-server/dns"
+)
+
+func TestInfraCacheExpires(t *testing.T) {
+	cache := &infraCache{entries: make(map[infraKey]infraEntry)}
+	host := dns.Name("NS1.example.net.")
+	cache.put(host, dns.RType.A, []net.IP{net.ParseIP("192.0.2.1")}, time.Hour)
+	cache.put(host, dns.RType.AAAA, []net.IP{net.ParseIP("2001:db8::1")}, time.Hour)
+	if got := cache.get("ns1.EXAMPLE.net."); len(got) != 2 {
+		t.Fatalf("get() = %v, want both addresses", got)
+	}
+
+	key := infraKey{host.Canonical(), dns.RType.AAAA}
+	entry := cache.entries[key]
+	entry.expires = time.Now().Add(-time.Second)
+	cache.entries[key] = entry
+	if got := cache.get(host); len(got) != 1 || !got[0].Equal(net.ParseIP("192.0.2.1")) {
+		t.Errorf("get() with an expired AAAA entry = %v, want the A address", got)
+	}
+	if _, ok := cache.entries[key]; ok {
+		t.Error("expired entry not removed")
+	}
+}
+
+func TestInfraCacheIsBounded(t *testing.T) {
+	cache := &infraCache{entries: make(map[infraKey]infraEntry)}
+	now := time.Now()
+	hostKey := func(i int) infraKey {
+		return infraKey{dns.Name(fmt.Sprintf("ns%d.example.net.", i)), dns.RType.A}
+	}
+	for i := range maxInfraEntries {
+		cache.entries[hostKey(i)] = infraEntry{expires: now.Add(time.Hour), lastUsed: now.Add(-time.Duration(i) * time.Millisecond)}
+	}
+	expired := hostKey(0)
+	cache.entries[expired] = infraEntry{expires: now.Add(-time.Second), lastUsed: now}
+
+	cache.put("new1.example.net.", dns.RType.A, []net.IP{net.ParseIP("192.0.2.1")}, time.Hour)
+	if len(cache.entries) != maxInfraEntries {
+		t.Errorf("caching %d entries, want %d", len(cache.entries), maxInfraEntries)
+	}
+	if _, ok := cache.entries[expired]; ok {
+		t.Error("expired entry not evicted")
+	}
+
+	// With nothing expired, the least recently used entry makes room.
+	lru := hostKey(maxInfraEntries - 1)
+	cache.put("new2.example.net.", dns.RType.A, []net.IP{net.ParseIP("192.0.2.2")}, time.Hour)
+	if len(cache.entries) != maxInfraEntries {
+		t.Errorf("caching %d entries, want %d", len(cache.entries), maxInfraEntries)
+	}
+	if _, ok := cache.entries[lru]; ok {
+		t.Errorf("least recently used entry %s not evicted", lru.host)
+	}
+
+	// Replacing a cached entry does not evict anything.
+	cache.put("new2.example.net.", dns.RType.A, []net.IP{net.ParseIP("192.0.2.3")}, time.Hour)
+	if len(cache.entries) != maxInfraEntries {
+		t.Errorf("caching %d entries after an update, want %d", len(cache.entries), maxInfraEntries)
+	}
+}
@@ -1,11 +1,92 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"net"
+
+	"github.com/rounakkumarsingh/dns-server/dns"
 )
 
+// ShowUnicode prints the A-labels (xn--...) of answered packets as the
+// Unicode labels they encode. It only changes what is printed: names are
+// always sent, compared and logged in ASCII form.
+var ShowUnicode = false
+
+// presentation formats a packet for printing, honouring ShowUnicode.
+func presentation(packet dns.DNSPacket) string {
+	if !ShowUnicode {
+		return packet.String()
+	}
+
+	questions := make([]dns.DNSQuestion, len(packet.Questions))
+	for i, question := range packet.Questions {
+		question.Domain = unicodeName(question.Domain)
+		questions[i] = question
+	}
+	packet.Questions = questions
+	packet.Answers = unicodeRecords(packet.Answers)
+	packet.Authoratives = unicodeRecords(packet.Authoratives)
+	packet.Additional = unicodeRecords(packet.Additional)
+	return packet.String()
+}
+
+// unicodeName returns name with its A-labels shown as Unicode. The result is
+// only fit for printing.
+func unicodeName(name dns.Name) dns.Name {
+	return dns.Name(name.ToUnicode())
+}
+
+// unicodeRecords returns a copy of records with the owner names and the names
+// in their RDATA shown as Unicode. Text in the RDATA, like that of TXT
+// records, is left alone.
+func unicodeRecords(records []dns.DNSRecord) []dns.DNSRecord {
+	if records == nil {
+		return nil
+	}
+	result := make([]dns.DNSRecord, len(records))
+	for i, record := range records {
+		switch r := record.(type) {
+		case dns.ADNSRecord:
+			r.Name = unicodeName(r.Name)
+			record = r
+		case dns.AAAARecord:
+			r.Name = unicodeName(r.Name)
+			record = r
+		case dns.NSDNSRecord:
+			r.Name, r.Host = unicodeName(r.Name), unicodeName(r.Host)
+			record = r
+		case dns.CNAMERecord:
+			r.Name, r.CanonicalName = unicodeName(r.Name), unicodeName(r.CanonicalName)
+			record = r
+		case dns.DNAMERecord:
+			r.Name, r.Target = unicodeName(r.Name), unicodeName(r.Target)
+			record = r
+		case dns.MXRecord:
+			r.Name, r.Exchange = unicodeName(r.Name), unicodeName(r.Exchange)
+			record = r
+		case dns.SOARecord:
+			r.Name, r.MName, r.RName = unicodeName(r.Name), unicodeName(r.MName), unicodeName(r.RName)
+			record = r
+		case dns.PTRRecord:
+			r.Name, r.Pointer = unicodeName(r.Name), unicodeName(r.Pointer)
+			record = r
+		case dns.TXTRecord:
+			r.Name = unicodeName(r.Name)
+			record = r
+		case dns.SPFRecord:
+			r.Name = unicodeName(r.Name)
+			record = r
+		case dns.UnknownRecord:
+			r.Name = unicodeName(r.Name)
+			record = r
+		}
+		result[i] = record
+	}
+	return result
+}
+
 func main() {
 
 	defer func() {
@@ -14,6 +95,57 @@ func main() {
 		}
 	}()
 
+	zonesFile := flag.String("zones", "", "path to a forward/stub zone routing table")
+	rootHintsFile := flag.String("root-hints", "named.root", "path to a root hints file, the built-in root servers are used if it cannot be loaded")
+	priming := flag.Bool("priming", true, "refresh the root servers with a priming query at startup and whenever their TTL expires")
+	qnameMinimisation := flag.String("qname-minimisation", QnameMinimisation.String(), "QNAME minimisation mode: off, relaxed or strict")
+	multiQuestion := flag.String("multi-question", MultiQuestion.String(), "how to answer queries with several questions: formerr, first or each")
+	flag.DurationVar(&QueryTimeBudget, "query-budget", QueryTimeBudget, "maximum time spent resolving a single client query")
+	serverUDPSize := flag.Uint("udp-size", uint(ServerUDPSize), "EDNS UDP payload size advertised to clients")
+	upstreamUDPSize := flag.Uint("edns-bufsize", uint(UpstreamUDPSize), "EDNS UDP payload size advertised to upstream servers")
+	flag.BoolVar(&DNSSECValidation, "dnssec", DNSSECValidation, "set the DNSSEC OK bit in upstream queries")
+	flag.BoolVar(&CaseRandomization, "case-randomization", CaseRandomization, "randomise the case of names in iterative queries (0x20)")
+	flag.BoolVar(&ShowUnicode, "idn-unicode", ShowUnicode, "print internationalized names in responses with Unicode labels instead of xn-- labels")
+	flag.Parse()
+
+	if *serverUDPSize < minUDPSize || *serverUDPSize > 65535 || *upstreamUDPSize < minUDPSize || *upstreamUDPSize > 65535 {
+		log.Println("Invalid flag: EDNS UDP sizes must be between 512 and 65535")
+		return
+	}
+	ServerUDPSize = uint16(*serverUDPSize)
+	UpstreamUDPSize = uint16(*upstreamUDPSize)
+
+	mode, err := parseQnameMinimisationMode(*qnameMinimisation)
+	if err != nil {
+		log.Println("Invalid flag:", err)
+		return
+	}
+	QnameMinimisation = mode
+
+	policy, err := parseMultiQuestionPolicy(*multiQuestion)
+	if err != nil {
+		log.Println("Invalid flag:", err)
+		return
+	}
+	MultiQuestion = policy
+
+	if servers, err := loadRootHints(*rootHintsFile); err != nil {
+		log.Println("Using built-in root servers:", err)
+	} else {
+		setRootServers(servers)
+	}
+	if *priming {
+		go keepRootServersPrimed()
+	}
+	go logMismatchStats()
+
+	if *zonesFile != "" {
+		if err := loadZoneRoutes(*zonesFile); err != nil {
+			log.Println("Failed to load zone routes:", err)
+			return
+		}
+	}
+
 	udpAddr, err := net.ResolveUDPAddr("udp", ":1053")
 	if err != nil {
 		log.Println("Failed to resolve UDP address:", err)
@@ -36,14 +168,14 @@ func main() {
 			continue
 		}
 
-		responsePacket, err := handlePacket(buf[:n])
+		responsePacket, maxSize, err := handlePacket(buf[:n])
 		if err != nil {
 			log.Println("Failed to handle DNS packet:", err)
 			continue
 		}
 
-		fmt.Println(responsePacket)
-		updatedPacket, err := responsePacket.ToBytes()
+		fmt.Println(presentation(responsePacket))
+		updatedPacket, err := responsePacket.ToBytesLimit(maxSize)
 		if err != nil {
 			log.Println("Failed to convert DNS packet to bytes:", err)
 			continue
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rounakkumarsingh/dns-server/dns"
+)
+
+func TestPresentation(t *testing.T) {
+	packet := dns.DNSPacket{
+		Header:    dns.DNSHeader{ID: 1, QR: 1, QDCOUNT: 1, ANCOUNT: 4},
+		Questions: []dns.DNSQuestion{{Domain: "www.xn--bcher-kva.example.", Type: dns.RType.A, Class: dns.ClassType.IN}},
+		Answers: []dns.DNSRecord{
+			cname("www.xn--bcher-kva.example.", "a-xn--bcher-kva.example."),
+			aRecord("a-xn--bcher-kva.example.", "192.0.2.1"),
+			dns.TXTRecord{DNSRecordPreamble: preamble("xn--mnchen-3ya.example.", dns.RType.TXT), Text: "see xn--bcher-kva.example"},
+			dns.MXRecord{DNSRecordPreamble: preamble("example.", dns.RType.MX), Preference: 10, Exchange: "mail.xn--mnchen-3ya.example."},
+		},
+	}
+	defer func(show bool) { ShowUnicode = show }(ShowUnicode)
+
+	ShowUnicode = false
+	if text := presentation(packet); !strings.Contains(text, "www.xn--bcher-kva.example.") || strings.Contains(text, "ü") {
+		t.Errorf("presentation without ShowUnicode = %q", text)
+	}
+
+	ShowUnicode = true
+	text := presentation(packet)
+	for _, want := range []string{
+		"Domain: www.bücher.example.",
+		"Name: www.bücher.example.",
+		"Name: münchen.example.",
+		"Exchange: mail.münchen.example.",
+		// Only whole labels are A-labels.
+		"Canonical Name: a-xn--bcher-kva.example.",
+		"Name: a-xn--bcher-kva.example.",
+		// RDATA text is not a name.
+		"Text: see xn--bcher-kva.example",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("presentation with ShowUnicode is missing %q:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "a-bücher") {
+		t.Errorf("presentation with ShowUnicode converted part of a label:\n%s", text)
+	}
+
+	if packet.Questions[0].Domain != "www.xn--bcher-kva.example." || packet.Answers[0].Preamble().Name != "www.xn--bcher-kva.example." {
+		t.Error("presentation changed the packet")
+	}
+	if packet.Questions[0].Domain.String() != "www.xn--bcher-kva.example." {
+		t.Errorf("Name.String() = %q changed with ShowUnicode", packet.Questions[0].Domain.String())
+	}
+}
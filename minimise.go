@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rounakkumarsingh/dns-server/dns"
+)
+
+// QnameMinimisationMode controls how much of the query name resolve() reveals
+// to the servers above the zone that actually holds the name (RFC 9156).
+type QnameMinimisationMode uint8
+
+const (
+	// QnameMinimisationOff sends the full query name to every server.
+	QnameMinimisationOff QnameMinimisationMode = iota
+	// QnameMinimisationRelaxed retries with the full query name when a server
+	// answers a minimised query with an error, which works around servers that
+	// return NXDOMAIN for empty non-terminals.
+	QnameMinimisationRelaxed
+	// QnameMinimisationStrict never reveals more than one extra label and
+	// treats errors for a minimised query as final.
+	QnameMinimisationStrict
+)
+
+// Limits from RFC 9156 section 3 that bound the number of queries spent on
+// names with many labels.
+const (
+	maxMinimiseCount = 10
+	minimiseOneLabel = 4
+)
+
+var QnameMinimisation = QnameMinimisationRelaxed
+
+func (m QnameMinimisationMode) String() string {
+	switch m {
+	case QnameMinimisationOff:
+		return "off"
+	case QnameMinimisationRelaxed:
+		return "relaxed"
+	case QnameMinimisationStrict:
+		return "strict"
+	default:
+		return "unknown"
+	}
+}
+
+func parseQnameMinimisationMode(mode string) (QnameMinimisationMode, error) {
+	switch strings.ToLower(mode) {
+	case "off":
+		return QnameMinimisationOff, nil
+	case "relaxed":
+		return QnameMinimisationRelaxed, nil
+	case "strict":
+		return QnameMinimisationStrict, nil
+	default:
+		return QnameMinimisationOff, fmt.Errorf("unknown QNAME minimisation mode %q", mode)
+	}
+}
+
+// minimisedQuestion returns the next name to ask about when walking down from
+// ancestor towards domain. Once the whole name has been revealed it returns
+// the original question.
+func minimisedQuestion(ancestor dns.Name, domain dns.Name, recordType dns.RecordType, minimiseCount int) (dns.Name, dns.RecordType) {
+	known := ancestor.CountLabels()
+	remaining := domain.CountLabels() - known
+
+	reveal := 1
+	if minimiseCount >= maxMinimiseCount {
+		reveal = remaining
+	} else if minimiseCount >= minimiseOneLabel {
+		reveal = max(1, remaining/(maxMinimiseCount-minimiseCount))
+	}
+	if reveal >= remaining {
+		return domain, recordType
+	}
+
+	// RFC 9156 recommends QTYPE A for the intermediate queries, since it
+	// looks like any other lookup and is answered correctly by more servers
+	// than NS.
+	return domain.Suffix(known + reveal), dns.RType.A
+}
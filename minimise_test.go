@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/rounakkumarsingh/dns-server/dns"
+)
+
+func TestParseQnameMinimisationMode(t *testing.T) {
+	for _, mode := range []QnameMinimisationMode{QnameMinimisationOff, QnameMinimisationRelaxed, QnameMinimisationStrict} {
+		parsed, err := parseQnameMinimisationMode(strings.ToUpper(mode.String()))
+		if err != nil || parsed != mode {
+			t.Errorf("parseQnameMinimisationMode(%q) = %v, %v", strings.ToUpper(mode.String()), parsed, err)
+		}
+	}
+	for _, mode := range []string{"", "on", "unknown"} {
+		if _, err := parseQnameMinimisationMode(mode); err == nil {
+			t.Errorf("parseQnameMinimisationMode(%q) accepted an unknown mode", mode)
+		}
+	}
+}
+
+// longName returns a name of count labels ending in example.
+func longName(count int) dns.Name {
+	labels := []string{"example"}
+	for i := 1; i < count; i++ {
+		labels = append([]string{fmt.Sprintf("l%d", i)}, labels...)
+	}
+	return dns.Name(strings.Join(labels, ".") + ".")
+}
+
+func TestMinimisedQuestion(t *testing.T) {
+	tests := []struct {
+		name   string
+		zone   dns.Name
+		domain dns.Name
+		// The number of labels revealed by each query, the last one asking
+		// the original question.
+		want []int
+	}{
+		{"TLD from the root", ".", "com.", []int{1}},
+		{"from the root", ".", "www.example.com.", []int{1, 2, 3}},
+		{"from a TLD", "com.", "www.example.com.", []int{2, 3}},
+		{"from the zone of the name", "example.com.", "www.example.com.", []int{3}},
+		{"10 labels from the root", ".", longName(10), []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}},
+		{"15 labels from the root", ".", longName(15), []int{1, 2, 3, 4, 5, 7, 9, 11, 13, 15}},
+		{"40 labels from the root", ".", longName(40), []int{1, 2, 3, 4, 10, 16, 22, 28, 34, 40}},
+		{"14 labels from a TLD", "example.", longName(14), []int{2, 3, 4, 5, 6, 7, 8, 10, 12, 14}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Walk down the way resolve does when no zone cut is found.
+			var revealed []int
+			qname, qtype := minimisedQuestion(tt.zone, tt.domain, dns.RType.MX, 0)
+			for count := 1; ; count++ {
+				if !tt.domain.IsSubdomainOf(qname) {
+					t.Fatalf("step %d asks about %s, which is not above %s", count, qname, tt.domain)
+				}
+				revealed = append(revealed, qname.CountLabels())
+				if qname == tt.domain {
+					if qtype != dns.RType.MX {
+						t.Errorf("final query type = %s, want MX", qtype)
+					}
+					break
+				}
+				if qtype != dns.RType.A {
+					t.Errorf("step %d query type = %s, want A", count, qtype)
+				}
+				if count > maxMinimiseCount {
+					t.Fatalf("still minimising after %d queries: %v", count, revealed)
+				}
+				qname, qtype = minimisedQuestion(qname, tt.domain, dns.RType.MX, count)
+			}
+			if !slices.Equal(revealed, tt.want) {
+				t.Errorf("labels per query = %v, want %v", revealed, tt.want)
+			}
+		})
+	}
+
+	// After maxMinimiseCount queries the whole name is revealed at once.
+	if qname, qtype := minimisedQuestion(".", longName(20), dns.RType.MX, maxMinimiseCount); qname != longName(20) || qtype != dns.RType.MX {
+		t.Errorf("minimisedQuestion() at the limit = %s %s, want the original question", qname, qtype)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rounakkumarsingh/dns-server/dns"
+)
+
+// MismatchReason tells why an upstream response was discarded.
+type MismatchReason uint8
+
+const (
+	// MismatchSource is a datagram from an address or port we did not query.
+	MismatchSource MismatchReason = iota
+	// MismatchID is a message whose ID differs from the query's.
+	MismatchID
+	// MismatchNotResponse is a message without the QR bit set.
+	MismatchNotResponse
+	// MismatchQuestion is a response to a different question.
+	MismatchQuestion
+	// MismatchCase is a response that did not echo the random case of the
+	// question name.
+	MismatchCase
+	// MismatchMalformed is a datagram that could not be parsed.
+	MismatchMalformed
+)
+
+func (r MismatchReason) String() string {
+	switch r {
+	case MismatchSource:
+		return "source"
+	case MismatchID:
+		return "id"
+	case MismatchNotResponse:
+		return "not a response"
+	case MismatchQuestion:
+		return "question"
+	case MismatchCase:
+		return "case"
+	case MismatchMalformed:
+		return "malformed"
+	default:
+		return "unknown"
+	}
+}
+
+// mismatchCounter counts the upstream responses that did not match the query
+// they arrived for. A burst of them usually means someone is trying to spoof
+// answers into the resolver.
+type mismatchCounter struct {
+	mu     sync.Mutex
+	counts map[MismatchReason]uint64
+}
+
+var responseMismatches = &mismatchCounter{counts: make(map[MismatchReason]uint64)}
+
+// mismatchStatsInterval is how often the mismatch counts are logged.
+const mismatchStatsInterval = 10 * time.Minute
+
+// add counts one mismatch and returns the number seen for that reason so far.
+func (c *mismatchCounter) add(reason MismatchReason) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.counts[reason]++
+	return c.counts[reason]
+}
+
+// count returns the number of mismatches seen for reason.
+func (c *mismatchCounter) count(reason MismatchReason) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.counts[reason]
+}
+
+// String lists the mismatch counts by reason, for the periodic stats log.
+func (c *mismatchCounter) String() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var parts []string
+	for reason := MismatchSource; reason <= MismatchMalformed; reason++ {
+		parts = append(parts, fmt.Sprintf("%s=%d", reason, c.counts[reason]))
+	}
+	return strings.Join(parts, " ")
+}
+
+// logMismatchStats logs the mismatch counts every mismatchStatsInterval.
+func logMismatchStats() {
+	for range time.Tick(mismatchStatsInterval) {
+		log.Println("Discarded upstream responses:", responseMismatches)
+	}
+}
+
+// responseMismatch checks that response answers queryPacket. Servers that
+// reject a query with FORMERR or NOTIMP, and truncated responses, may leave
+// out the question section.
+func responseMismatch(queryPacket dns.DNSPacket, response *dns.DNSPacket) (MismatchReason, error) {
+	if response.Header.ID != queryPacket.Header.ID {
+		return MismatchID, fmt.Errorf("ID %d does not match query ID %d", response.Header.ID, queryPacket.Header.ID)
+	}
+	if response.Header.QR != 1 {
+		return MismatchNotResponse, fmt.Errorf("message %d is not a response", response.Header.ID)
+	}
+
+	if len(response.Questions) == 0 && questionOptional(response) {
+		return 0, nil
+	}
+	if len(response.Questions) != len(queryPacket.Questions) {
+		return MismatchQuestion, fmt.Errorf("response has %d questions, query had %d", len(response.Questions), len(queryPacket.Questions))
+	}
+	for i, question := range response.Questions {
+		asked := queryPacket.Questions[i]
+		if !question.Domain.Equal(asked.Domain) || question.Type != asked.Type || question.Class != asked.Class {
+			return MismatchQuestion, fmt.Errorf("response is for %s %s, query was for %s %s", question.Domain, question.Type, asked.Domain, asked.Type)
+		}
+	}
+	return 0, nil
+}
+
+// questionOptional reports whether response may leave out the question
+// section: it is truncated or rejects the query with FORMERR or NOTIMP.
+func questionOptional(response *dns.DNSPacket) bool {
+	rcode := response.Header.RCODE
+	return response.Header.TC == 1 || rcode == dns.DNSResponseCodeType.FormatError || rcode == dns.DNSResponseCodeType.NotImplemented
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/rounakkumarsingh/dns-server/dns"
+)
+
+func TestResponseMismatch(t *testing.T) {
+	query := dns.DNSPacket{
+		Header:    dns.DNSHeader{ID: 42, QDCOUNT: 1},
+		Questions: []dns.DNSQuestion{{Domain: "example.com.", Type: dns.RType.A, Class: dns.ClassType.IN}},
+	}
+	response := func(id uint16, qr uint8, rcode dns.DNSResponseCode, questions ...dns.DNSQuestion) *dns.DNSPacket {
+		return &dns.DNSPacket{Header: dns.DNSHeader{ID: id, QR: qr, RCODE: rcode}, Questions: questions}
+	}
+	question := func(domain dns.Name, recordType dns.RecordType) dns.DNSQuestion {
+		return dns.DNSQuestion{Domain: domain, Type: recordType, Class: dns.ClassType.IN}
+	}
+
+	tests := []struct {
+		name       string
+		response   *dns.DNSPacket
+		wantReason MismatchReason
+		mismatch   bool
+	}{
+		{"matching", response(42, 1, dns.DNSResponseCodeType.NoError, question("EXAMPLE.com.", dns.RType.A)), 0, false},
+		{"foreign ID", response(43, 1, dns.DNSResponseCodeType.NoError, question("example.com.", dns.RType.A)), MismatchID, true},
+		{"query", response(42, 0, dns.DNSResponseCodeType.NoError, question("example.com.", dns.RType.A)), MismatchNotResponse, true},
+		{"other name", response(42, 1, dns.DNSResponseCodeType.NoError, question("example.net.", dns.RType.A)), MismatchQuestion, true},
+		{"other type", response(42, 1, dns.DNSResponseCodeType.NoError, question("example.com.", dns.RType.AAAA)), MismatchQuestion, true},
+		{"no question", response(42, 1, dns.DNSResponseCodeType.NoError), MismatchQuestion, true},
+		{"no question, FORMERR", response(42, 1, dns.DNSResponseCodeType.FormatError), 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason, err := responseMismatch(query, tt.response)
+			if (err != nil) != tt.mismatch || reason != tt.wantReason {
+				t.Errorf("responseMismatch() = %s, %v, want %s (mismatch %v)", reason, err, tt.wantReason, tt.mismatch)
+			}
+		})
+	}
+}
+
+func TestMismatchCounter(t *testing.T) {
+	counter := &mismatchCounter{counts: make(map[MismatchReason]uint64)}
+	counter.add(MismatchID)
+	counter.add(MismatchID)
+	counter.add(MismatchCase)
+
+	if got := counter.count(MismatchID); got != 2 {
+		t.Errorf("count(MismatchID) = %d, want 2", got)
+	}
+	if got := counter.count(MismatchSource); got != 0 {
+		t.Errorf("count(MismatchSource) = %d, want 0", got)
+	}
+	want := "source=0 id=2 not a response=0 question=0 case=1 malformed=0"
+	if got := counter.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/rounakkumarsingh/dns-server/dns"
+)
+
+// MultiQuestionPolicy decides how queries with more than one question are
+// answered. RFC 1035 allows them but leaves their meaning undefined.
+type MultiQuestionPolicy uint8
+
+const (
+	// MultiQuestionFormErr rejects the query with FORMERR.
+	MultiQuestionFormErr MultiQuestionPolicy = iota
+	// MultiQuestionFirst answers the first question and drops the others
+	// from the response.
+	MultiQuestionFirst
+	// MultiQuestionEach answers every question and combines the answers in
+	// one response, see addAnswer.
+	MultiQuestionEach
+)
+
+var MultiQuestion = MultiQuestionFormErr
+
+func (p MultiQuestionPolicy) String() string {
+	switch p {
+	case MultiQuestionFormErr:
+		return "formerr"
+	case MultiQuestionFirst:
+		return "first"
+	case MultiQuestionEach:
+		return "each"
+	default:
+		return "unknown"
+	}
+}
+
+func parseMultiQuestionPolicy(policy string) (MultiQuestionPolicy, error) {
+	switch strings.ToLower(policy) {
+	case "formerr":
+		return MultiQuestionFormErr, nil
+	case "first":
+		return MultiQuestionFirst, nil
+	case "each":
+		return MultiQuestionEach, nil
+	default:
+		return MultiQuestionFormErr, fmt.Errorf("unknown multi-question policy %q", policy)
+	}
+}
+
+// addAnswer merges the outcome of looking up one question into
+// responsePacket. Answers are appended in question order. The first question
+// that fails sets the RCODE and the Extended DNS Error in serverOPT, later
+// failures are only logged. A failure with an upstream RCODE, like NXDOMAIN,
+// keeps the records that came with it, so with MultiQuestionEach a response
+// can carry the answers of some questions next to the aliases and SOA of a
+// failed one, under the RCODE of the first failure.
+func addAnswer(responsePacket *dns.DNSPacket, serverOPT *dns.OPTRecord, answers []dns.DNSRecord, err error) {
+	if err == nil {
+		responsePacket.Answers = append(responsePacket.Answers, answers...)
+		return
+	}
+
+	log.Println("Failed to resolve DNS query:", err)
+	var rescodeErr RESCODEError
+	if !errors.As(err, &rescodeErr) {
+		rescodeErr = serverFailure(dns.EDECodeType.Other, "%v", err)
+	}
+	if rescodeErr.Code != dns.DNSResponseCodeType.ServerFailure {
+		appendNegativeAnswer(responsePacket, answers)
+	}
+	if responsePacket.Header.RCODE != dns.DNSResponseCodeType.NoError {
+		return
+	}
+	responsePacket.Header.RCODE = rescodeErr.Code
+	if serverOPT != nil && rescodeErr.ExtendedError != nil {
+		if err := serverOPT.SetOption(*rescodeErr.ExtendedError); err != nil {
+			log.Println("Failed to attach extended error:", err)
+		}
+	}
+}
+
+// appendNegativeAnswer adds the records that came with an error response code
+// to the response. The SOA of a negative answer goes to the authority section
+// so the client can cache it, and the CNAME and DNAME records that led to the
+// name stay in the answer section.
+func appendNegativeAnswer(responsePacket *dns.DNSPacket, records []dns.DNSRecord) {
+	for _, record := range records {
+		if record.Preamble().Type == dns.RType.SOA {
+			responsePacket.Authoratives = append(responsePacket.Authoratives, record)
+		} else {
+			responsePacket.Answers = append(responsePacket.Answers, record)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/rounakkumarsingh/dns-server/dns"
+)
+
+func TestParseMultiQuestionPolicy(t *testing.T) {
+	for _, policy := range []MultiQuestionPolicy{MultiQuestionFormErr, MultiQuestionFirst, MultiQuestionEach} {
+		parsed, err := parseMultiQuestionPolicy(policy.String())
+		if err != nil || parsed != policy {
+			t.Errorf("parseMultiQuestionPolicy(%q) = %v, %v", policy, parsed, err)
+		}
+	}
+	if _, err := parseMultiQuestionPolicy("all"); err == nil {
+		t.Error("parseMultiQuestionPolicy accepted an unknown policy")
+	}
+}
+
+// TestAddAnswer builds the combined response of a MultiQuestionEach query
+// whose second question is NXDOMAIN behind a CNAME and whose third fails.
+func TestAddAnswer(t *testing.T) {
+	soa := dns.SOARecord{DNSRecordPreamble: preamble("example.net.", dns.RType.SOA), MName: "ns.example.net.", RName: "hostmaster.example.net."}
+	var responsePacket dns.DNSPacket
+	serverOPT := &dns.OPTRecord{Name: ".", UDPSize: 1232}
+
+	addAnswer(&responsePacket, serverOPT, []dns.DNSRecord{aRecord("a.example.com.", "192.0.2.1")}, nil)
+	addAnswer(&responsePacket, serverOPT, []dns.DNSRecord{cname("b.example.com.", "gone.example.net."), soa}, RESCODEError{Code: dns.DNSResponseCodeType.NameError})
+	addAnswer(&responsePacket, serverOPT, []dns.DNSRecord{cname("c.example.com.", "lame.example.org.")}, serverFailure(dns.EDECodeType.NoReachableAuthority, "lame"))
+	addAnswer(&responsePacket, serverOPT, []dns.DNSRecord{aRecord("d.example.com.", "192.0.2.4")}, nil)
+	addAnswer(&responsePacket, serverOPT, nil, errors.New("network down"))
+
+	if responsePacket.Header.RCODE != dns.DNSResponseCodeType.NameError {
+		t.Errorf("RCODE = %s, want the first failure's NXDOMAIN", responsePacket.Header.RCODE)
+	}
+	wantAnswers := []string{"A a.example.com.", "CNAME b.example.com.", "A d.example.com."}
+	if got := recordNames(responsePacket.Answers); !slices.Equal(got, wantAnswers) {
+		t.Errorf("answers = %v, want %v", got, wantAnswers)
+	}
+	wantAuthority := []string{"SOA example.net."}
+	if got := recordNames(responsePacket.Authoratives); !slices.Equal(got, wantAuthority) {
+		t.Errorf("authority = %v, want %v", got, wantAuthority)
+	}
+	if ede, _ := serverOPT.ExtendedError(); ede != nil {
+		t.Errorf("extended error %s attached for a later failure", ede)
+	}
+}
+
+func TestAddAnswerServerFailure(t *testing.T) {
+	var responsePacket dns.DNSPacket
+	serverOPT := &dns.OPTRecord{Name: ".", UDPSize: 1232}
+	addAnswer(&responsePacket, serverOPT, []dns.DNSRecord{cname("c.example.com.", "lame.example.org.")}, serverFailure(dns.EDECodeType.NoReachableAuthority, "lame"))
+
+	if responsePacket.Header.RCODE != dns.DNSResponseCodeType.ServerFailure {
+		t.Errorf("RCODE = %s, want SERVFAIL", responsePacket.Header.RCODE)
+	}
+	if len(responsePacket.Answers) != 0 {
+		t.Errorf("answers = %v, want none with SERVFAIL", recordNames(responsePacket.Answers))
+	}
+	ede, err := serverOPT.ExtendedError()
+	if err != nil || ede == nil || ede.InfoCode != dns.EDECodeType.NoReachableAuthority {
+		t.Errorf("extended error = %v, %v", ede, err)
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rounakkumarsingh/dns-server/dns"
+)
+
+// builtinRootServers is used when no root hints file can be loaded.
+var builtinRootServers = map[dns.Name][]net.IP{
+	"a.root-servers.net.": {net.ParseIP("198.41.0.4"), net.ParseIP("2001:503:ba3e::2:30")},
+	"b.root-servers.net.": {net.ParseIP("170.247.170.2"), net.ParseIP("2801:1b8:10::b")},
+	"c.root-servers.net.": {net.ParseIP("192.33.4.12"), net.ParseIP("2001:500:2::c")},
+	"d.root-servers.net.": {net.ParseIP("199.7.91.13"), net.ParseIP("2001:500:2d::d")},
+	"e.root-servers.net.": {net.ParseIP("192.203.230.10"), net.ParseIP("2001:500:a8::e")},
+	"f.root-servers.net.": {net.ParseIP("192.5.5.241"), net.ParseIP("2001:500:2f::f")},
+	"g.root-servers.net.": {net.ParseIP("192.112.36.4"), net.ParseIP("2001:500:12::d0d")},
+	"h.root-servers.net.": {net.ParseIP("198.97.190.53"), net.ParseIP("2001:500:1::53")},
+	"i.root-servers.net.": {net.ParseIP("192.36.148.17"), net.ParseIP("2001:7fe::53")},
+	"j.root-servers.net.": {net.ParseIP("192.58.128.30"), net.ParseIP("2001:503:c27::2:30")},
+	"k.root-servers.net.": {net.ParseIP("193.0.14.129"), net.ParseIP("2001:7fd::1")},
+	"l.root-servers.net.": {net.ParseIP("199.7.83.42"), net.ParseIP("2001:500:9f::42")},
+	"m.root-servers.net.": {net.ParseIP("202.12.27.33"), net.ParseIP("2001:dc3::35")},
+}
+
+const (
+	// The root NS set is primed again when its TTL runs out, within these
+	// bounds. A failed priming query is retried after primingRetry.
+	minPrimingInterval = 5 * time.Minute
+	maxPrimingInterval = 7 * 24 * time.Hour
+	primingRetry       = time.Minute
+)
+
+var (
+	rootServersMu sync.RWMutex
+	// currentRootServers maps root server host names to their addresses. The
+	// map is replaced as a whole and never modified.
+	currentRootServers = builtinRootServers
+)
+
+// rootServers returns the nameservers of the root zone.
+func rootServers() map[dns.Name][]net.IP {
+	rootServersMu.RLock()
+	defer rootServersMu.RUnlock()
+
+	return currentRootServers
+}
+
+func setRootServers(servers map[dns.Name][]net.IP) {
+	rootServersMu.Lock()
+	defer rootServersMu.Unlock()
+
+	currentRootServers = servers
+}
+
+// loadRootHints reads a root hints file in the named.root format, a zone file
+// with the NS records of the root and the A and AAAA records of their hosts:
+//
+//	.                        3600000      NS    A.ROOT-SERVERS.NET.
+//	A.ROOT-SERVERS.NET.      3600000      A     198.41.0.4
+//
+// Everything after a ';' is treated as a comment. $TTL is ignored and $ORIGIN
+// may only name the root. Hosts without an address are left out.
+func loadRootHints(path string) (map[dns.Name][]net.IP, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	servers := make(map[dns.Name][]net.IP)
+	addresses := make(map[dns.Name][]net.IP)
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+		if i := strings.IndexByte(line, ';'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if strings.HasPrefix(fields[0], "$") {
+			if err := rootHintsDirective(fields); err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", path, lineNumber, err)
+			}
+			continue
+		}
+
+		// The TTL and class are optional.
+		name := dns.Name(fields[0]).Canonical()
+		fields = fields[1:]
+		if len(fields) > 0 {
+			if _, err := strconv.ParseUint(fields[0], 10, 32); err == nil {
+				fields = fields[1:]
+			}
+		}
+		if len(fields) > 0 && strings.EqualFold(fields[0], "IN") {
+			fields = fields[1:]
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected a record type and a value", path, lineNumber)
+		}
+
+		switch strings.ToUpper(fields[0]) {
+		case "NS":
+			if !name.IsRoot() {
+				return nil, fmt.Errorf("%s:%d: NS record for %s instead of the root", path, lineNumber, name)
+			}
+			servers[dns.Name(fields[1]).Canonical()] = nil
+		case "A", "AAAA":
+			ip := net.ParseIP(fields[1])
+			if ip == nil {
+				return nil, fmt.Errorf("%s:%d: invalid address %q", path, lineNumber, fields[1])
+			}
+			addresses[name] = append(addresses[name], ip)
+		default:
+			return nil, fmt.Errorf("%s:%d: unexpected record type %q", path, lineNumber, fields[0])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for host := range servers {
+		if len(addresses[host]) == 0 {
+			log.Printf("Root hints list no address for %s", host)
+			delete(servers, host)
+			continue
+		}
+		servers[host] = addresses[host]
+	}
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("%s: no root servers with addresses", path)
+	}
+	return servers, nil
+}
+
+// rootHintsDirective checks a zone file directive of a root hints file. The
+// TTLs of hints do not matter, so $TTL is ignored, and names are always
+// absolute, so $ORIGIN may only name the root.
+func rootHintsDirective(fields []string) error {
+	switch strings.ToUpper(fields[0]) {
+	case "$TTL":
+		if len(fields) != 2 {
+			return errors.New("$TTL needs a value")
+		}
+		return nil
+	case "$ORIGIN":
+		if len(fields) != 2 || !dns.Name(fields[1]).IsRoot() {
+			return errors.New("$ORIGIN must be the root")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported directive %s", fields[0])
+	}
+}
+
+// primeRootServers sends a priming query (RFC 8109) for the NS records of the
+// root to the current root servers and replaces them with the servers and
+// addresses of the response. It returns the TTL of the root NS set.
+func primeRootServers() (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), QueryTimeBudget)
+	defer cancel()
+
+	current := rootServers()
+	responsePacket, err := queryServers(ctx, nameserverAddresses(ctx, dns.RootName, current), buildQuery(dns.RootName, dns.RType.NS, 0), false)
+	if err != nil {
+		return 0, err
+	}
+	servers, ttl, err := primingServers(responsePacket, current)
+	if err != nil {
+		return 0, err
+	}
+
+	setRootServers(servers)
+	log.Printf("Primed %d root servers, next priming in %s", len(servers), ttl)
+	return ttl, nil
+}
+
+// primingServers extracts the root servers and the TTL of the root NS set
+// from a priming response. Hosts that come without glue keep the addresses
+// in current. It fails when the response has no usable root server, in which
+// case the current servers should be kept.
+func primingServers(responsePacket *dns.DNSPacket, current map[dns.Name][]net.IP) (map[dns.Name][]net.IP, time.Duration, error) {
+	if responsePacket.Header.RCODE != dns.DNSResponseCodeType.NoError {
+		return nil, 0, fmt.Errorf("priming query answered %s", responsePacket.Header.RCODE)
+	}
+
+	servers := make(map[dns.Name][]net.IP)
+	ttl := maxPrimingInterval
+	for _, answer := range responsePacket.Answers {
+		if record, ok := answer.(dns.NSDNSRecord); ok && record.Name.IsRoot() {
+			servers[record.Host.Canonical()] = nil
+			ttl = min(ttl, time.Duration(record.TTL)*time.Second)
+		}
+	}
+	if len(servers) == 0 {
+		return nil, 0, errors.New("priming response has no NS records for the root")
+	}
+
+	for _, additionalRecord := range responsePacket.Additional {
+		var host dns.Name
+		var ip net.IP
+		switch record := additionalRecord.(type) {
+		case dns.ADNSRecord:
+			host, ip = record.Name.Canonical(), record.IP
+		case dns.AAAARecord:
+			host, ip = record.Name.Canonical(), record.IP
+		default:
+			continue
+		}
+		if ips, ok := servers[host]; ok {
+			servers[host] = append(ips, ip)
+		}
+	}
+	for host, ips := range servers {
+		if len(ips) > 0 {
+			continue
+		}
+		// Keep the addresses we already knew for hosts that came without glue.
+		if known, ok := current[host]; ok {
+			servers[host] = known
+		} else {
+			delete(servers, host)
+		}
+	}
+	if len(servers) == 0 {
+		return nil, 0, errors.New("priming response has no root server addresses")
+	}
+	return servers, ttl, nil
+}
+
+// keepRootServersPrimed primes the root servers and repeats it whenever the
+// TTL of the root NS set expires.
+func keepRootServersPrimed() {
+	for {
+		ttl, err := primeRootServers()
+		if err != nil {
+			log.Println("Root priming failed:", err)
+			time.Sleep(primingRetry)
+			continue
+		}
+		time.Sleep(min(max(ttl, minPrimingInterval), maxPrimingInterval))
+	}
+}
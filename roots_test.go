@@ -0,0 +1,141 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/rounakkumarsingh/dns-server/dns"
+)
+
+// addressStrings turns a server map into host -> addresses for comparison.
+func addressStrings(servers map[dns.Name][]net.IP) map[dns.Name][]string {
+	result := make(map[dns.Name][]string)
+	for host, ips := range servers {
+		for _, ip := range ips {
+			result[host] = append(result[host], ip.String())
+		}
+	}
+	return result
+}
+
+func equalServers(t *testing.T, got map[dns.Name][]net.IP, want map[dns.Name][]string) {
+	t.Helper()
+	gotStrings := addressStrings(got)
+	if len(gotStrings) != len(want) {
+		t.Fatalf("servers = %v, want %v", gotStrings, want)
+	}
+	for host, ips := range want {
+		if !slices.Equal(gotStrings[host], ips) {
+			t.Errorf("servers[%s] = %v, want %v", host, gotStrings[host], ips)
+		}
+	}
+}
+
+func TestLoadRootHints(t *testing.T) {
+	servers, err := loadRootHints(filepath.Join("testdata", "named.root"))
+	if err != nil {
+		t.Fatalf("loadRootHints() error = %v", err)
+	}
+	// z.root-servers.net. has no address and is left out.
+	equalServers(t, servers, map[dns.Name][]string{
+		"a.root-servers.net.": {"198.41.0.4", "2001:503:ba3e::2:30"},
+		"b.root-servers.net.": {"170.247.170.2", "2801:1b8:10::b"},
+		"c.root-servers.net.": {"192.33.4.12"},
+	})
+}
+
+func TestLoadRootHintsErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		hints string
+	}{
+		{"NS not at the root", "com. 3600 NS a.gtld-servers.net.\na.gtld-servers.net. A 192.5.6.30\n"},
+		{"invalid address", ". NS a.root-servers.net.\na.root-servers.net. A 198.41.0.999\n"},
+		{"unexpected type", ". NS a.root-servers.net.\na.root-servers.net. CNAME b.root-servers.net.\n"},
+		{"missing value", ". NS\n"},
+		{"too many fields", ". 3600 IN NS a.root-servers.net. extra\n"},
+		{"no glue at all", ". NS a.root-servers.net.\n"},
+		{"empty", "; nothing but comments\n"},
+		{"$TTL without value", "$TTL\n. NS a.root-servers.net.\na.root-servers.net. A 198.41.0.4\n"},
+		{"$ORIGIN not the root", "$ORIGIN example.\n. NS a.root-servers.net.\na.root-servers.net. A 198.41.0.4\n"},
+		{"$INCLUDE", "$INCLUDE other.root\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "named.root")
+			if err := os.WriteFile(path, []byte(tt.hints), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if servers, err := loadRootHints(path); err == nil {
+				t.Errorf("loadRootHints() = %v, want an error", servers)
+			}
+		})
+	}
+
+	if _, err := loadRootHints(filepath.Join("testdata", "missing.root")); err == nil {
+		t.Error("loadRootHints() of a missing file succeeded")
+	}
+}
+
+func TestPrimingServers(t *testing.T) {
+	current := map[dns.Name][]net.IP{
+		"a.root-servers.net.": {net.ParseIP("198.41.0.4")},
+		"b.root-servers.net.": {net.ParseIP("199.9.14.201")},
+	}
+	ns := func(host dns.Name, ttl uint32) dns.NSDNSRecord {
+		record := nsRecord(".", host)
+		record.TTL = ttl
+		return record
+	}
+	aaaa := func(host dns.Name, ip string) dns.AAAARecord {
+		return dns.AAAARecord{DNSRecordPreamble: preamble(host, dns.RType.AAAA), IP: net.ParseIP(ip)}
+	}
+
+	t.Run("usable response", func(t *testing.T) {
+		responsePacket := &dns.DNSPacket{
+			Answers: []dns.DNSRecord{
+				ns("A.ROOT-SERVERS.NET.", 518400),
+				ns("b.root-servers.net.", 86400),
+				ns("n.root-servers.net.", 518400),
+				nsRecord("com.", "a.gtld-servers.net."),
+			},
+			Additional: []dns.DNSRecord{
+				aRecord("a.root-servers.net.", "198.41.0.4"),
+				aaaa("A.root-servers.net.", "2001:503:ba3e::2:30"),
+				aRecord("a.gtld-servers.net.", "192.5.6.30"),
+			},
+		}
+		servers, ttl, err := primingServers(responsePacket, current)
+		if err != nil {
+			t.Fatalf("primingServers() error = %v", err)
+		}
+		if ttl != 24*time.Hour {
+			t.Errorf("ttl = %s, want the smallest NS TTL", ttl)
+		}
+		// b keeps its known address, n has none and is dropped.
+		equalServers(t, servers, map[dns.Name][]string{
+			"a.root-servers.net.": {"198.41.0.4", "2001:503:ba3e::2:30"},
+			"b.root-servers.net.": {"199.9.14.201"},
+		})
+	})
+
+	unusable := []struct {
+		name           string
+		responsePacket *dns.DNSPacket
+	}{
+		{"error response", &dns.DNSPacket{Header: dns.DNSHeader{RCODE: dns.DNSResponseCodeType.Refused}, Answers: []dns.DNSRecord{ns("a.root-servers.net.", 60)}}},
+		{"no root NS records", &dns.DNSPacket{Answers: []dns.DNSRecord{nsRecord("com.", "a.gtld-servers.net.")}}},
+		{"no addresses", &dns.DNSPacket{Answers: []dns.DNSRecord{ns("x.root-servers.net.", 60)}, Additional: []dns.DNSRecord{aRecord("y.root-servers.net.", "192.0.2.1")}}},
+	}
+	for _, tt := range unusable {
+		t.Run(tt.name, func(t *testing.T) {
+			if servers, _, err := primingServers(tt.responsePacket, current); err == nil {
+				t.Errorf("primingServers() = %v, want an error so the current servers are kept", servers)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"math/rand"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// Servers we have never talked to get a small random RTT so that they are
+	// tried early and the tracker learns about them.
+	maxInitialRTT = 32 * time.Millisecond
+	// maxRTT caps the penalty applied for repeated timeouts.
+	maxRTT = 10 * time.Second
+	// rttSmoothing is the weight of a new sample in the smoothed RTT.
+	rttSmoothing = 0.3
+	// rttDecay slowly lowers the RTT of servers that were not picked so that
+	// a penalised server is eventually tried again.
+	rttDecay = 0.98
+	// explorationRate is the probability of trying a server other than the
+	// fastest one first.
+	explorationRate = 0.05
+	// Every attempt waits a few times the server's RTT, within these bounds.
+	minAttemptTimeout = 200 * time.Millisecond
+	maxAttemptTimeout = 800 * time.Millisecond
+	// Servers not queried for rttMemory are forgotten, and at most
+	// maxTrackedServers are remembered at all.
+	rttMemory         = 15 * time.Minute
+	maxTrackedServers = 10000
+)
+
+// rttEntry is the smoothed RTT of a server and when it was last looked up.
+type rttEntry struct {
+	srtt     time.Duration
+	lastUsed time.Time
+}
+
+// rttTracker keeps a smoothed round trip time for every nameserver address we
+// have queried recently.
+type rttTracker struct {
+	mu   sync.Mutex
+	srtt map[string]rttEntry
+}
+
+var serverRTTs = &rttTracker{srtt: make(map[string]rttEntry)}
+
+// get returns the smoothed RTT of ip. The caller must hold t.mu.
+func (t *rttTracker) get(ip net.IP) time.Duration {
+	now := time.Now()
+	entry, ok := t.srtt[ip.String()]
+	if !ok || now.Sub(entry.lastUsed) > rttMemory {
+		if !ok && len(t.srtt) >= maxTrackedServers {
+			t.evict(now)
+		}
+		entry.srtt = time.Duration(rand.Int63n(int64(maxInitialRTT)))
+	}
+	entry.lastUsed = now
+	t.srtt[ip.String()] = entry
+	return entry.srtt
+}
+
+// set stores the smoothed RTT of ip, which get has just looked up. The caller
+// must hold t.mu.
+func (t *rttTracker) set(ip net.IP, srtt time.Duration) {
+	entry := t.srtt[ip.String()]
+	entry.srtt = srtt
+	t.srtt[ip.String()] = entry
+}
+
+// evict makes room for a new server by forgetting the ones not used for
+// rttMemory, or the least recently used one if all are fresh. The caller must
+// hold t.mu.
+func (t *rttTracker) evict(now time.Time) {
+	var oldest string
+	for ip, entry := range t.srtt {
+		if now.Sub(entry.lastUsed) > rttMemory {
+			delete(t.srtt, ip)
+			continue
+		}
+		if oldest == "" || entry.lastUsed.Before(t.srtt[oldest].lastUsed) {
+			oldest = ip
+		}
+	}
+	if len(t.srtt) >= maxTrackedServers {
+		delete(t.srtt, oldest)
+	}
+}
+
+// record folds a measured round trip time into the server's smoothed RTT.
+func (t *rttTracker) record(ip net.IP, rtt time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	srtt := t.get(ip)
+	t.set(ip, time.Duration((1-rttSmoothing)*float64(srtt)+rttSmoothing*float64(rtt)))
+}
+
+// penalise doubles the smoothed RTT of a server that timed out or failed,
+// using at least the time we spent waiting for it.
+func (t *rttTracker) penalise(ip net.IP, waited time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	srtt := max(t.get(ip)*2, waited)
+	t.set(ip, min(srtt, maxRTT))
+}
+
+// attemptTimeout returns how long to wait for a single answer from ip before
+// moving on to the next server.
+func (t *rttTracker) attemptTimeout(ip net.IP) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return min(max(t.get(ip)*4, minAttemptTimeout), maxAttemptTimeout)
+}
+
+// order returns addresses sorted from the fastest to the slowest known
+// server. Occasionally a random server is moved to the front so that servers
+// which got faster are noticed.
+func (t *rttTracker) order(addresses []net.IP) []net.IP {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ordered := make([]net.IP, len(addresses))
+	copy(ordered, addresses)
+	rtts := make(map[string]time.Duration, len(ordered))
+	for _, ip := range ordered {
+		rtts[ip.String()] = t.get(ip)
+	}
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return rtts[ordered[i].String()] < rtts[ordered[j].String()]
+	})
+
+	if len(ordered) > 1 && rand.Float64() < explorationRate {
+		k := 1 + rand.Intn(len(ordered)-1)
+		ordered[0], ordered[k] = ordered[k], ordered[0]
+	}
+
+	for _, ip := range ordered[1:] {
+		t.set(ip, time.Duration(float64(rtts[ip.String()])*rttDecay))
+	}
+
+	return ordered
+}
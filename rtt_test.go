@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestRTTTrackerForgetsStaleServers(t *testing.T) {
+	tracker := &rttTracker{srtt: make(map[string]rttEntry)}
+	ip := net.ParseIP("192.0.2.1")
+	tracker.penalise(ip, 5*time.Second)
+	if got := tracker.srtt[ip.String()].srtt; got != 5*time.Second {
+		t.Fatalf("srtt after penalty = %s, want 5s", got)
+	}
+
+	entry := tracker.srtt[ip.String()]
+	entry.lastUsed = time.Now().Add(-rttMemory - time.Second)
+	tracker.srtt[ip.String()] = entry
+	if got := tracker.attemptTimeout(ip); got != minAttemptTimeout {
+		t.Errorf("attemptTimeout of a forgotten server = %s, want %s", got, minAttemptTimeout)
+	}
+}
+
+func TestRTTTrackerIsBounded(t *testing.T) {
+	tracker := &rttTracker{srtt: make(map[string]rttEntry)}
+	now := time.Now()
+	for i := range maxTrackedServers {
+		tracker.srtt[fmt.Sprintf("10.0.%d.%d", i/256, i%256)] = rttEntry{srtt: time.Millisecond, lastUsed: now.Add(-time.Duration(i) * time.Millisecond)}
+	}
+	stale := net.ParseIP("10.0.0.1").String()
+	tracker.srtt[stale] = rttEntry{srtt: time.Millisecond, lastUsed: now.Add(-2 * rttMemory)}
+
+	tracker.record(net.ParseIP("192.0.2.1"), 10*time.Millisecond)
+	if len(tracker.srtt) != maxTrackedServers {
+		t.Errorf("tracking %d servers, want %d", len(tracker.srtt), maxTrackedServers)
+	}
+	if _, ok := tracker.srtt[stale]; ok {
+		t.Error("stale server not evicted")
+	}
+
+	// With every entry fresh, the least recently used one makes room.
+	lru := fmt.Sprintf("10.0.%d.%d", (maxTrackedServers-1)/256, (maxTrackedServers-1)%256)
+	tracker.record(net.ParseIP("192.0.2.2"), 10*time.Millisecond)
+	if len(tracker.srtt) != maxTrackedServers {
+		t.Errorf("tracking %d servers, want %d", len(tracker.srtt), maxTrackedServers)
+	}
+	if _, ok := tracker.srtt[lru]; ok {
+		t.Errorf("least recently used server %s not evicted", lru)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/rounakkumarsingh/dns-server/dns"
+)
+
+type ZoneRouteMode uint8
+
+const (
+	// RouteForward sends queries with RD set to recursive forwarders.
+	RouteForward ZoneRouteMode = iota
+	// RouteStub starts iterative resolution at the given nameservers
+	// instead of the root servers.
+	RouteStub
+)
+
+func (m ZoneRouteMode) String() string {
+	switch m {
+	case RouteForward:
+		return "forward"
+	case RouteStub:
+		return "stub"
+	default:
+		return "unknown"
+	}
+}
+
+// ZoneRoute tells the server how to answer queries at or below Zone.
+type ZoneRoute struct {
+	Zone    dns.Name
+	Mode    ZoneRouteMode
+	Servers []net.IP
+}
+
+// ZoneRoutes maps the canonical name of a zone to its route.
+var ZoneRoutes = map[dns.Name]ZoneRoute{}
+
+// loadZoneRoutes reads a routing table where every non-empty line has the form
+//
+//	<zone> <forward|stub> <ip> [<ip>...]
+//
+// Everything after a '#' is treated as a comment.
+func loadZoneRoutes(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 3 {
+			return fmt.Errorf("%s:%d: expected a zone, a mode and at least one server", path, lineNumber)
+		}
+
+		zone, err := dns.ToASCII(fields[0])
+		if err != nil {
+			return fmt.Errorf("%s:%d: %v", path, lineNumber, err)
+		}
+		route := ZoneRoute{Zone: zone.Canonical()}
+		switch strings.ToLower(fields[1]) {
+		case "forward":
+			route.Mode = RouteForward
+		case "stub":
+			route.Mode = RouteStub
+		default:
+			return fmt.Errorf("%s:%d: unknown mode %q", path, lineNumber, fields[1])
+		}
+		for _, field := range fields[2:] {
+			ip := net.ParseIP(field)
+			if ip == nil {
+				return fmt.Errorf("%s:%d: invalid server address %q", path, lineNumber, field)
+			}
+			route.Servers = append(route.Servers, ip)
+		}
+
+		ZoneRoutes[route.Zone] = route
+		log.Printf("Routing %s via %s %v", route.Zone, route.Mode, route.Servers)
+	}
+	return scanner.Err()
+}
+
+// findZoneRoute returns the route of the longest configured zone that is
+// equal to or a parent of domain.
+func findZoneRoute(domain dns.Name) (ZoneRoute, bool) {
+	if len(ZoneRoutes) == 0 {
+		return ZoneRoute{}, false
+	}
+	name := domain.Canonical()
+	for {
+		if route, ok := ZoneRoutes[name]; ok {
+			return route, true
+		}
+		if name.IsRoot() {
+			return ZoneRoute{}, false
+		}
+		name = name.Parent()
+	}
+}
+
+// forward sends a recursive query to the configured forwarders, starting with
+// the fastest one, and returns the answers of the first one that responds.
+func forward(ctx context.Context, route ZoneRoute, domain dns.Name, recordType dns.RecordType) ([]dns.DNSRecord, error) {
+	responsePacket, err := queryServers(ctx, route.Servers, buildQuery(domain, recordType, 1), false)
+	if err != nil {
+		return nil, err
+	}
+	if responsePacket.Header.RCODE != dns.DNSResponseCodeType.NoError {
+		return rcodeRecords(responsePacket), upstreamError(responsePacket, route.Zone)
+	}
+	return responsePacket.Answers, nil
+}
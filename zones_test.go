@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rounakkumarsingh/dns-server/dns"
+)
+
+// writeZoneRoutes writes a routing table to a temporary file.
+func writeZoneRoutes(t *testing.T, table string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "zones")
+	if err := os.WriteFile(path, []byte(table), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadZoneRoutes(t *testing.T) {
+	defer func(routes map[dns.Name]ZoneRoute) { ZoneRoutes = routes }(ZoneRoutes)
+	ZoneRoutes = map[dns.Name]ZoneRoute{}
+
+	path := writeZoneRoutes(t, `# Internal zones
+corp.example      forward 10.0.0.53 10.0.1.53   # primary and backup
+Sub.Corp.Example. stub    10.1.0.53
+
+10.in-addr.arpa   FORWARD 10.0.0.53
+bücher.example    stub    2001:db8::53
+`)
+	if err := loadZoneRoutes(path); err != nil {
+		t.Fatalf("loadZoneRoutes() error = %v", err)
+	}
+
+	want := map[dns.Name]string{
+		"corp.example.":          "forward [10.0.0.53 10.0.1.53]",
+		"sub.corp.example.":      "stub [10.1.0.53]",
+		"10.in-addr.arpa.":       "forward [10.0.0.53]",
+		"xn--bcher-kva.example.": "stub [2001:db8::53]",
+	}
+	if len(ZoneRoutes) != len(want) {
+		t.Errorf("loaded %d routes, want %d: %v", len(ZoneRoutes), len(want), ZoneRoutes)
+	}
+	for zone, route := range want {
+		got, ok := ZoneRoutes[zone]
+		if !ok {
+			t.Errorf("no route for %s", zone)
+			continue
+		}
+		if s := fmt.Sprintf("%s %v", got.Mode, got.Servers); s != route || got.Zone != zone {
+			t.Errorf("route for %s = %s %s, want %s", zone, got.Zone, s, route)
+		}
+	}
+}
+
+func TestLoadZoneRoutesErrors(t *testing.T) {
+	defer func(routes map[dns.Name]ZoneRoute) { ZoneRoutes = routes }(ZoneRoutes)
+
+	tests := []struct {
+		name  string
+		table string
+	}{
+		{"no servers", "corp.example forward\n"},
+		{"no mode", "corp.example\n"},
+		{"unknown mode", "corp.example recursive 10.0.0.53\n"},
+		{"invalid address", "corp.example forward 10.0.0.256\n"},
+		{"host name as server", "corp.example stub ns.corp.example\n"},
+		{"invalid zone", "xn--zzzzzzzzz.example forward 10.0.0.53\n"},
+		{"comment hides the servers", "corp.example forward # 10.0.0.53\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ZoneRoutes = map[dns.Name]ZoneRoute{}
+			path := writeZoneRoutes(t, "# zones\n"+tt.table)
+			err := loadZoneRoutes(path)
+			if err == nil {
+				t.Fatal("loadZoneRoutes() succeeded")
+			}
+			if !strings.HasPrefix(err.Error(), path+":2: ") {
+				t.Errorf("error %q does not name line 2 of %s", err, path)
+			}
+		})
+	}
+
+	if err := loadZoneRoutes(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("loadZoneRoutes() of a missing file succeeded")
+	}
+}
+
+func TestFindZoneRoute(t *testing.T) {
+	defer func(routes map[dns.Name]ZoneRoute) { ZoneRoutes = routes }(ZoneRoutes)
+
+	ZoneRoutes = map[dns.Name]ZoneRoute{}
+	if route, ok := findZoneRoute("www.corp.example."); ok {
+		t.Errorf("findZoneRoute() without routes = %v", route)
+	}
+
+	ZoneRoutes = map[dns.Name]ZoneRoute{}
+	for _, route := range []ZoneRoute{
+		{Zone: "corp.example.", Mode: RouteForward, Servers: []net.IP{net.ParseIP("10.0.0.53")}},
+		{Zone: "sub.corp.example.", Mode: RouteStub, Servers: []net.IP{net.ParseIP("10.1.0.53")}},
+		{Zone: "10.in-addr.arpa.", Mode: RouteForward, Servers: []net.IP{net.ParseIP("10.0.0.53")}},
+		{Zone: "xn--bcher-kva.example.", Mode: RouteStub, Servers: []net.IP{net.ParseIP("2001:db8::53")}},
+	} {
+		ZoneRoutes[route.Zone] = route
+	}
+
+	tests := []struct {
+		domain dns.Name
+		want   dns.Name // empty when no route applies
+	}{
+		{"corp.example.", "corp.example."},
+		{"www.CORP.example.", "corp.example."},
+		{"sub.corp.example.", "sub.corp.example."},
+		{"a.b.SUB.corp.example.", "sub.corp.example."},
+		{"subsub.corp.example.", "corp.example."},
+		{"othercorp.example.", ""},
+		{"example.", ""},
+		{".", ""},
+		{"4.3.2.10.in-addr.arpa.", "10.in-addr.arpa."},
+		{"10.in-addr.arpa.", "10.in-addr.arpa."},
+		{"4.3.2.110.in-addr.arpa.", ""},
+		{"www.xn--bcher-kva.example.", "xn--bcher-kva.example."},
+		{`corp\.example.`, ""},
+	}
+	for _, tt := range tests {
+		route, ok := findZoneRoute(tt.domain)
+		if ok != (tt.want != "") || route.Zone != tt.want {
+			t.Errorf("findZoneRoute(%q) = %q, %v, want %q", tt.domain, route.Zone, ok, tt.want)
+		}
+	}
+}